@@ -0,0 +1,323 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/FarmRadioHangar/fastc/asteriskconf"
+)
+
+// managerFile is the configuration file of the asterisk manager interface.
+const managerFile = "manager.conf"
+
+// amiTimeout is how long the client waits for asterisk to answer an action.
+const amiTimeout = 10 * time.Second
+
+// AMIResponse is the response of asterisk to an action. Headers are keyed by
+// their lower case names, Output holds the output of a Command action.
+type AMIResponse struct {
+	Response string
+	Message  string
+	Headers  map[string]string
+	Output   []string
+}
+
+// AMIError is an action that asterisk answered with an error.
+type AMIError struct {
+	Action  string
+	Message string
+}
+
+func (e *AMIError) Error() string {
+	return fmt.Sprintf("ami: %s failed: %s", e.Action, e.Message)
+}
+
+// AMIClient is a client of the asterisk manager interface. Actions are sent
+// one at a time, the events asterisk sends in between are skipped.
+type AMIClient struct {
+	conn    net.Conn
+	r       *bufio.Reader
+	id      int
+	Timeout time.Duration
+}
+
+// DialAMI connects to the manager interface listening on addr.
+func DialAMI(addr string) (*AMIClient, error) {
+	conn, err := net.DialTimeout("tcp", addr, amiTimeout)
+	if err != nil {
+		return nil, err
+	}
+	c := &AMIClient{conn: conn, r: bufio.NewReader(conn), Timeout: amiTimeout}
+	conn.SetReadDeadline(time.Now().Add(c.Timeout))
+	banner, err := c.r.ReadString('\n')
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if !strings.HasPrefix(banner, "Asterisk Call Manager") {
+		conn.Close()
+		return nil, fmt.Errorf("ami: unexpected banner %q", strings.TrimSpace(banner))
+	}
+	return c, nil
+}
+
+// Action sends the action name with the given headers, and returns the response
+// of asterisk. An *AMIError is returned with the response when asterisk
+// answers with an error.
+func (c *AMIClient) Action(name string, headers ...[2]string) (*AMIResponse, error) {
+	c.id++
+	id := "fastc-" + strconv.Itoa(c.id)
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "Action: %s\r\nActionID: %s\r\n", name, id)
+	for _, v := range headers {
+		fmt.Fprintf(&b, "%s: %s\r\n", v[0], v[1])
+	}
+	b.WriteString("\r\n")
+	c.conn.SetDeadline(time.Now().Add(c.Timeout))
+	if _, err := c.conn.Write(b.Bytes()); err != nil {
+		return nil, err
+	}
+	for {
+		r, err := c.read()
+		if err != nil {
+			return nil, err
+		}
+		if r.Response == "" || r.Headers["actionid"] != id {
+			continue
+		}
+		if strings.EqualFold(r.Response, "error") {
+			return r, &AMIError{Action: name, Message: r.Message}
+		}
+		return r, nil
+	}
+}
+
+// read reads the next message sent by asterisk. The output of a Command action
+// is either sent after a Response: Follows header and ended by --END COMMAND--,
+// or as Output headers by asterisk 14 and later.
+func (c *AMIClient) read() (*AMIResponse, error) {
+	r := &AMIResponse{Headers: make(map[string]string)}
+	follows := false
+	for {
+		line, err := c.r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		line = strings.TrimRight(line, "\r\n")
+		if line == "" {
+			return r, nil
+		}
+		if follows {
+			if i := strings.Index(line, "--END COMMAND--"); i != -1 {
+				if line = line[:i]; line != "" {
+					r.Output = append(r.Output, line)
+				}
+				follows = false
+				continue
+			}
+		}
+		i := strings.Index(line, ": ")
+		key := ""
+		if i != -1 {
+			key = strings.ToLower(line[:i])
+		}
+		if follows && key != "actionid" && key != "privilege" {
+			r.Output = append(r.Output, line)
+			continue
+		}
+		if i == -1 {
+			continue
+		}
+		value := line[i+2:]
+		switch key {
+		case "response":
+			r.Response = value
+			follows = strings.EqualFold(value, "follows")
+		case "message":
+			r.Message = value
+		case "output":
+			r.Output = append(r.Output, value)
+		}
+		r.Headers[key] = value
+	}
+}
+
+// Login authenticates the client as user.
+func (c *AMIClient) Login(user, secret string) error {
+	_, err := c.Action("Login",
+		[2]string{"Username", user},
+		[2]string{"Secret", secret},
+		[2]string{"Events", "off"},
+	)
+	return err
+}
+
+// Command runs the asterisk CLI command cmd, and returns its output.
+func (c *AMIClient) Command(cmd string) ([]string, error) {
+	r, err := c.Action("Command", [2]string{"Command", cmd})
+	if err != nil {
+		return nil, err
+	}
+	return r.Output, nil
+}
+
+// Reload reloads the asterisk module named module.
+func (c *AMIClient) Reload(module string) (string, error) {
+	r, err := c.Action("Reload", [2]string{"Module", module})
+	if err != nil {
+		return "", err
+	}
+	return r.Message, nil
+}
+
+// Close logs off and closes the connection.
+func (c *AMIClient) Close() error {
+	c.Action("Logoff")
+	return c.conn.Close()
+}
+
+// amiConfig is the address of the manager interface and the credentials fastc
+// logs in with.
+type amiConfig struct {
+	addr   string
+	user   string
+	secret string
+}
+
+// readManagerConf reads the address of the manager interface and the
+// credentials of user from the manager.conf file of dir. When user is empty, the
+// first user with a secret that can run commands and reload modules is used.
+func readManagerConf(dir, user string) (*amiConfig, error) {
+	a, err := asteriskconf.ParseFile(dir, managerFile, asteriskconf.IncludeFiles)
+	if err != nil {
+		return nil, err
+	}
+	host, port := "127.0.0.1", "5038"
+	if g, err := a.Section("general"); err == nil {
+		if v, err := g.Get("enabled"); err == nil && !isTrue(v) {
+			return nil, errors.New("the manager interface is disabled in " + managerFile)
+		}
+		if v, err := g.Get("port"); err == nil {
+			port = v
+		}
+		if v, err := g.Get("bindaddr"); err == nil {
+			switch v {
+			case "0.0.0.0":
+			case "::":
+				host = "::1"
+			default:
+				host = v
+			}
+		}
+	}
+	for _, s := range a.Sections {
+		name := s.Name()
+		if name == "general" || name == "main" || s.IsTemplate() || s.Appends() {
+			continue
+		}
+		if user != "" && name != user {
+			continue
+		}
+		secret, err := s.Get("secret")
+		if err != nil {
+			continue
+		}
+		if user == "" && !canReload(s.GetAll("write")) {
+			continue
+		}
+		return &amiConfig{
+			addr:   net.JoinHostPort(host, port),
+			user:   name,
+			secret: secret,
+		}, nil
+	}
+	if user != "" {
+		return nil, fmt.Errorf("no manager user %s with a secret in %s", user, managerFile)
+	}
+	return nil, errors.New("no manager user in " + managerFile + " can run commands and reload modules")
+}
+
+// canReload returns true if the write permissions of a manager user allow the
+// Command and Reload actions.
+func canReload(write []string) bool {
+	perms := make(map[string]bool)
+	for _, v := range write {
+		for _, p := range strings.Split(v, ",") {
+			perms[strings.TrimSpace(p)] = true
+		}
+	}
+	return perms["all"] || (perms["system"] && perms["command"])
+}
+
+// isTrue returns true if v is one of the true values of asterisk configuration
+// files.
+func isTrue(v string) bool {
+	switch strings.ToLower(v) {
+	case "yes", "true", "y", "t", "1", "on":
+		return true
+	}
+	return false
+}
+
+// amiStep is an action run to reload the asterisk configuration, either a
+// Command or the Reload of a module. A failed optional step, like reloading a
+// module that is not loaded, is reported without failing the reload.
+type amiStep struct {
+	action   string
+	arg      string
+	optional bool
+}
+
+// The steps reloading the configuration written by the dongles and sip
+// commands.
+var (
+	dongleReload = []amiStep{
+		{"Command", "dongle reload now", false},
+		{"Reload", "pbx_config.so", false},
+	}
+	sipReload = []amiStep{
+		{"Reload", "chan_sip.so", true},
+		{"Reload", "res_pjsip.so", true},
+		{"Reload", "pbx_config.so", false},
+	}
+)
+
+// reloadAsterisk logs in to the manager interface of c and runs steps, writing
+// their results to w.
+func reloadAsterisk(w io.Writer, c *amiConfig, steps []amiStep) error {
+	client, err := DialAMI(c.addr)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+	if err = client.Login(c.user, c.secret); err != nil {
+		return err
+	}
+	for _, v := range steps {
+		var out string
+		switch v.action {
+		case "Command":
+			var lines []string
+			lines, err = client.Command(v.arg)
+			out = strings.Join(lines, "; ")
+		default:
+			out, err = client.Reload(v.arg)
+		}
+		if err != nil {
+			if e, ok := err.(*AMIError); ok && v.optional {
+				fmt.Fprintf(w, "%s %s: skipped, %s\n", v.action, v.arg, e.Message)
+				continue
+			}
+			return err
+		}
+		fmt.Fprintf(w, "%s %s: %s\n", v.action, v.arg, out)
+	}
+	return nil
+}
@@ -0,0 +1,238 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeAMI is a manager interface server answering the actions fastc sends. The
+// Command output is sent in the Response: Follows format of asterisk 11, and
+// the modules in missing are not loaded.
+type fakeAMI struct {
+	l       net.Listener
+	user    string
+	secret  string
+	missing map[string]bool
+
+	mu      sync.Mutex
+	actions []string
+}
+
+func newFakeAMI(t *testing.T) *fakeAMI {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := &fakeAMI{l: l, user: "fastc", secret: "s3cret",
+		missing: map[string]bool{"res_pjsip.so": true}}
+	go f.serve()
+	return f
+}
+
+func (f *fakeAMI) serve() {
+	for {
+		conn, err := f.l.Accept()
+		if err != nil {
+			return
+		}
+		go f.handle(conn)
+	}
+}
+
+func (f *fakeAMI) handle(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	fmt.Fprint(conn, "Asterisk Call Manager/1.3\r\n")
+	loggedIn := false
+	for {
+		h := make(map[string]string)
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			line = strings.TrimRight(line, "\r\n")
+			if line == "" {
+				break
+			}
+			if i := strings.Index(line, ": "); i != -1 {
+				h[strings.ToLower(line[:i])] = line[i+2:]
+			}
+		}
+		action, id := h["action"], h["actionid"]
+		f.mu.Lock()
+		f.actions = append(f.actions, action+" "+h["command"]+h["module"])
+		f.mu.Unlock()
+
+		// an event sent before the response is skipped by the client
+		fmt.Fprint(conn, "Event: FullyBooted\r\nPrivilege: system,all\r\nStatus: Fully Booted\r\n\r\n")
+		switch {
+		case action == "Login":
+			if h["username"] != f.user || h["secret"] != f.secret {
+				fmt.Fprintf(conn, "Response: Error\r\nActionID: %s\r\nMessage: Authentication failed\r\n\r\n", id)
+				return
+			}
+			loggedIn = true
+			fmt.Fprintf(conn, "Response: Success\r\nActionID: %s\r\nMessage: Authentication accepted\r\n\r\n", id)
+		case action == "Logoff":
+			fmt.Fprintf(conn, "Response: Goodbye\r\nActionID: %s\r\nMessage: Thanks for all the fish.\r\n\r\n", id)
+			return
+		case !loggedIn:
+			fmt.Fprintf(conn, "Response: Error\r\nActionID: %s\r\nMessage: Permission denied\r\n\r\n", id)
+		case action == "Command":
+			fmt.Fprintf(conn, "Response: Follows\r\nPrivilege: Command\r\nActionID: %s\r\n[dongle] reload scheduled\nUsed: 2\n--END COMMAND--\r\n\r\n", id)
+		case action == "Reload" && f.missing[h["module"]]:
+			fmt.Fprintf(conn, "Response: Error\r\nActionID: %s\r\nMessage: No such module\r\n\r\n", id)
+		case action == "Reload":
+			fmt.Fprintf(conn, "Response: Success\r\nActionID: %s\r\nMessage: Module Reloaded\r\n\r\n", id)
+		default:
+			fmt.Fprintf(conn, "Response: Error\r\nActionID: %s\r\nMessage: Invalid/unknown command\r\n\r\n", id)
+		}
+	}
+}
+
+func (f *fakeAMI) received() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.actions...)
+}
+
+func TestAMIClient(t *testing.T) {
+	f := newFakeAMI(t)
+	defer f.l.Close()
+
+	c, err := DialAMI(f.l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = c.Command("dongle reload now"); err == nil {
+		t.Error("expected an error before logging in")
+	}
+	if err = c.Login("fastc", "s3cret"); err != nil {
+		t.Fatal(err)
+	}
+	out, err := c.Command("dongle reload now")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(out, "|") != "[dongle] reload scheduled|Used: 2" {
+		t.Errorf("unexpected command output %q", out)
+	}
+	msg, err := c.Reload("pbx_config.so")
+	if err != nil || msg != "Module Reloaded" {
+		t.Errorf("expected the module to be reloaded got %q %v", msg, err)
+	}
+	_, err = c.Reload("res_pjsip.so")
+	if e, ok := err.(*AMIError); !ok || e.Message != "No such module" {
+		t.Errorf("expected No such module got %v", err)
+	}
+	if err = c.Close(); err != nil {
+		t.Error(err)
+	}
+
+	c, err = DialAMI(f.l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if err = c.Login("fastc", "wrong"); err == nil {
+		t.Error("expected the login to fail")
+	}
+}
+
+func TestReadManagerConf(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fastc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	conf := `[general]
+enabled = yes
+port = 5039
+bindaddr = 0.0.0.0
+
+#include manager_custom.conf
+
+[monitor]
+secret = m0n
+read = all
+write = call
+
+[admin]
+secret = amp111
+read = all
+write = all
+`
+	custom := `[fastc]
+secret = s3cret
+write = system,command
+`
+	for name, v := range map[string]string{managerFile: conf, "manager_custom.conf": custom} {
+		if err = ioutil.WriteFile(filepath.Join(dir, name), []byte(v), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, v := range []struct {
+		user, expect, secret string
+	}{
+		{"", "fastc", "s3cret"},
+		{"admin", "admin", "amp111"},
+		{"monitor", "monitor", "m0n"},
+	} {
+		c, err := readManagerConf(dir, v.user)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if c.addr != "127.0.0.1:5039" || c.user != v.expect || c.secret != v.secret {
+			t.Errorf("unexpected config %+v", c)
+		}
+	}
+	if _, err = readManagerConf(dir, "nobody"); err == nil {
+		t.Error("expected an error for an unknown user")
+	}
+}
+
+func TestReload(t *testing.T) {
+	f := newFakeAMI(t)
+	defer f.l.Close()
+	dir, clean := asteriskTestDir(t)
+	defer clean()
+
+	host, port, err := net.SplitHostPort(f.l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	conf := fmt.Sprintf("[general]\nenabled=yes\nport=%s\nbindaddr=%s\n\n[fastc]\nsecret=s3cret\nwrite=all\n", port, host)
+	if err = ioutil.WriteFile(filepath.Join(dir, managerFile), []byte(conf), 0644); err != nil {
+		t.Fatal(err)
+	}
+	src := filepath.Join(dir, "trunks.json")
+	if err = ioutil.WriteFile(src, []byte(sipConfig), 0644); err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	app := newApp()
+	app.Writer = &buf
+	if err = app.Run([]string{"fastc", "sip", "--reload", src}); err != nil {
+		t.Fatal(err)
+	}
+	expect := `Reload chan_sip.so: Module Reloaded
+Reload res_pjsip.so: skipped, No such module
+Reload pbx_config.so: Module Reloaded
+`
+	if buf.String() != expect {
+		t.Errorf("expected\n%s\ngot\n%s", expect, buf.String())
+	}
+	actions := strings.Join(f.received(), "|")
+	if actions != "Login |Reload chan_sip.so|Reload res_pjsip.so|Reload pbx_config.so|Logoff " {
+		t.Errorf("unexpected actions %s", actions)
+	}
+}
@@ -0,0 +1,194 @@
+package asteriskconf
+
+// Node is a piece of the parsed source text.
+type Node interface {
+	Begin() int
+	End() int
+	Text() string
+}
+
+// Context is a section of a dialplan.
+type Context struct {
+	Head        Node
+	Templates   []Node
+	Assignments []AsignStmt
+	Objects     []Object
+	Extensions  []*Extension
+	Includes    []Node // include =>
+	Switches    []Node // switch =>
+}
+
+// Template is a dialplan context declared with the (!) option, it is only used
+// as a source of definitions for other contexts.
+type Template Context
+
+// AsignStmt is a definition using the = operator.
+type AsignStmt struct {
+	Left  []Node
+	Equal Node // =
+	Right []Node
+}
+
+// Object is a definition using the => operator.
+type Object struct {
+	Left   []Node
+	Assign Node // =>
+	Right  []Node
+}
+
+// Extension is a dialplan extension with all its priorities, in the order they
+// are defined in the context.
+type Extension struct {
+	Pattern    Node
+	Priorities []*Priority
+}
+
+// Priority is a step of an extension, defined with either
+//
+//	exten => pattern,priority(label),App(args)
+//	same => priority(label),App(args)
+type Priority struct {
+
+	// Number is the priority number after resolving n and s priorities, it is
+	// -1 for hints.
+	Number   int
+	Priority Node
+	Label    Node // nil when there is no label
+	App      Node
+	Args     Node // nil when the application has no arguments
+	Same     bool // defined with same =>
+	Line     int
+}
+
+// File is a parsed dialplan.
+type File struct {
+	Comments    []Node
+	Contexts    []Context
+	Assignments []AsignStmt
+	Objects     []Object
+	Templates   []Template
+}
+
+// textNode is a Node holding the text that starts at offset begin of the
+// source.
+type textNode struct {
+	begin int
+	text  string
+}
+
+func (t *textNode) Begin() int   { return t.begin }
+func (t *textNode) End() int     { return t.begin + len(t.text) }
+func (t *textNode) Text() string { return t.text }
+
+// tokensNode returns a Node holding the text of toks, which are expected to be
+// contiguous.
+func tokensNode(toks []*Token) Node {
+	if len(toks) == 0 {
+		return nil
+	}
+	n := &textNode{begin: toks[0].Begin}
+	for _, v := range toks {
+		n.text += v.Text
+	}
+	return n
+}
+
+// keyNode returns the key of the definition as a Node.
+func (n *NodeIdent) keyNode() Node {
+	if n.tokens == nil {
+		return &textNode{text: n.key}
+	}
+	var toks []*Token
+	for _, v := range n.tokens {
+		switch v.Type {
+		case Assign, Arrow, Append:
+			return tokensNode(trimSpace(toks))
+		}
+		toks = append(toks, v)
+	}
+	return tokensNode(trimSpace(toks))
+}
+
+// operatorNode returns the assignment operator of the definition as a Node.
+func (n *NodeIdent) operatorNode() Node {
+	for _, v := range n.tokens {
+		switch v.Type {
+		case Assign, Arrow, Append:
+			return tokensNode([]*Token{v})
+		}
+	}
+	return &textNode{text: n.Operator()}
+}
+
+// valueNode returns the value of the definition as a Node, with the text
+// exactly as it appears in the source. It returns nil if the value is empty.
+func (n *NodeIdent) valueNode() Node {
+	if n.tokens == nil {
+		if n.value == "" {
+			return nil
+		}
+		return &textNode{text: n.value}
+	}
+	begin, end := n.valueSpan()
+	return tokensNode(n.tokens[begin:end])
+}
+
+// headNode returns the name of the section as a Node.
+func (n *NodeSection) headNode() Node {
+	if n.tokens == nil {
+		return &textNode{text: n.name}
+	}
+	var toks []*Token
+	for _, v := range n.tokens {
+		switch v.Type {
+		case LBrace:
+			continue
+		case RBrace:
+			return tokensNode(trimSpace(toks))
+		}
+		toks = append(toks, v)
+	}
+	return tokensNode(trimSpace(toks))
+}
+
+// templateNodes returns the names of the templates listed in the section header
+// as Nodes.
+func (n *NodeSection) templateNodes() []Node {
+	if n.tokens == nil {
+		var o []Node
+		for _, v := range n.inherits {
+			o = append(o, &textNode{text: v})
+		}
+		return o
+	}
+	var o []Node
+	var toks []*Token
+	options := false
+	for _, v := range n.tokens {
+		if !options {
+			options = v.Type == LBracket
+			continue
+		}
+		switch v.Type {
+		case Ident:
+			toks = append(toks, v)
+		case Comma, RBracket:
+			if toks != nil {
+				o = append(o, tokensNode(toks))
+				toks = nil
+			}
+		}
+	}
+	return o
+}
+
+// trimSpace returns toks without the leading and trailing white space tokens.
+func trimSpace(toks []*Token) []*Token {
+	for len(toks) > 0 && toks[0].Type == WhiteSpace {
+		toks = toks[1:]
+	}
+	for len(toks) > 0 && toks[len(toks)-1].Type == WhiteSpace {
+		toks = toks[:len(toks)-1]
+	}
+	return toks
+}
@@ -0,0 +1,207 @@
+package asteriskconf
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// PrintCST writes src to dst preserving the comments, white space and new lines
+// of the parsed input. Printing an *Ast that was returned by Parser.Parse without
+// modifying it reproduces the parsed input byte for byte.
+//
+// Sections and definitions that were not parsed, like the ones added with
+// NodeSection.Set or loaded with LoadJSON, are printed one per line after the
+// last line of the section they belong to. It is an error for their values to
+// have new lines.
+func PrintCST(dst io.Writer, src *Ast) error {
+	p := &cstPrinter{w: dst, nl: src.newline()}
+	for _, v := range src.Sections {
+		if v.tokens != nil {
+			if v.file == src.file {
+				p.tokens(v.lead)
+				p.tokens(v.tokens)
+			}
+		} else if v.name != "main" {
+			p.line("[" + v.name + "]" + v.options())
+		}
+		d := v.directives
+		for i, sub := range v.values {
+			for ; len(d) > 0 && d[0].at <= i; d = d[1:] {
+				p.directive(src, d[0])
+			}
+			if sub.tokens != nil {
+				if sub.file == src.file {
+					p.tokens(sub.lead)
+					p.tokens(sub.tokens)
+				}
+				continue
+			}
+			if err := checkValue(sub.key, sub.value); err != nil {
+				return err
+			}
+			p.line(sub.key + sub.Operator() + escapeValue(sub.value))
+		}
+		for _, sub := range d {
+			p.directive(src, sub)
+		}
+	}
+	p.tokens(src.trail)
+	return p.err
+}
+
+// newline returns the new line used by the parsed input, falling back to '\n'
+// when nothing was parsed.
+func (a *Ast) newline() string {
+	for _, v := range a.tokens() {
+		if v.Type == NLine {
+			return v.Text
+		}
+	}
+	return "\n"
+}
+
+// tokens returns all the tokens kept in the *Ast, in the order they appear in
+// the input.
+func (a *Ast) tokens() []*Token {
+	var o []*Token
+	a.walk(func(lead *[]*Token, toks []*Token, _ string) {
+		o = append(o, *lead...)
+		o = append(o, toks...)
+	})
+	return append(o, a.trail...)
+}
+
+// walk calls fn with the lead, the tokens and the file of every section header,
+// definition and directive of the *Ast, in the order they are printed.
+func (a *Ast) walk(fn func(lead *[]*Token, toks []*Token, file string)) {
+	for _, v := range a.Sections {
+		fn(&v.lead, v.tokens, v.file)
+		d := v.directives
+		for i, sub := range v.values {
+			for ; len(d) > 0 && d[0].at <= i; d = d[1:] {
+				fn(&d[0].lead, d[0].tokens, d[0].file)
+			}
+			fn(&sub.lead, sub.tokens, sub.file)
+		}
+		for _, sub := range d {
+			fn(&sub.lead, sub.tokens, sub.file)
+		}
+	}
+}
+
+type cstPrinter struct {
+	w io.Writer
+	// nl is the new line written after printed lines.
+	nl string
+	// open is true when the last written text did not end with a new line.
+	open bool
+	err  error
+}
+
+func (p *cstPrinter) write(s string) {
+	if p.err != nil || s == "" {
+		return
+	}
+	_, p.err = io.WriteString(p.w, s)
+	p.open = s[len(s)-1] != '\n' && s[len(s)-1] != '\r'
+}
+
+func (p *cstPrinter) tokens(toks []*Token) {
+	for _, v := range toks {
+		p.write(v.Text)
+	}
+}
+
+// directive writes the directive d if it is part of the file of src.
+func (p *cstPrinter) directive(src *Ast, d *NodeDirective) {
+	if d.tokens == nil {
+		p.line("#" + d.name + " " + d.arg)
+		return
+	}
+	if d.file == src.file {
+		p.tokens(d.lead)
+		p.tokens(d.tokens)
+	}
+}
+
+// line writes s on a line of its own.
+func (p *cstPrinter) line(s string) {
+	if p.open {
+		p.write(p.nl)
+	}
+	p.write(s)
+	p.write(p.nl)
+}
+
+// Set sets the value of the first definition of key in the section to value. A
+// new definition is added at the end of the section if there is none. Values
+// can not have new lines, they would add lines to the file.
+//
+// Only the value of a parsed definition is replaced, its key, spacing and any
+// trailing comment are left as they are.
+func (n *NodeSection) Set(key, value string) error {
+	if err := checkValue(key, value); err != nil {
+		return err
+	}
+	for _, v := range n.Values() {
+		if v.key == key {
+			v.setValue(value)
+			return nil
+		}
+	}
+	n.values = append(n.values, &NodeIdent{key: key, value: value, assign: Assign})
+	return nil
+}
+
+// checkValue returns an error if value, the value of key, has a new line.
+func checkValue(key, value string) error {
+	if strings.ContainsAny(value, "\r\n") {
+		return fmt.Errorf("the value of %s can not have new lines", key)
+	}
+	return nil
+}
+
+// setValue updates the value of n together with the value tokens of its line.
+func (n *NodeIdent) setValue(value string) {
+	n.value = value
+	if n.tokens == nil {
+		return
+	}
+	begin, end := n.valueSpan()
+	tok := &Token{Type: Value, Text: escapeValue(value), Line: n.line}
+	if begin < len(n.tokens) {
+		tok.Begin = n.tokens[begin].Begin
+		tok.Column = n.tokens[begin].Column
+	}
+	toks := make([]*Token, 0, len(n.tokens))
+	toks = append(toks, n.tokens[:begin]...)
+	toks = append(toks, tok)
+	n.tokens = append(toks, n.tokens[end:]...)
+}
+
+// valueSpan returns the range of n.tokens holding the value of the definition.
+// Spaces around the value and the trailing comment are not part of it.
+func (n *NodeIdent) valueSpan() (begin, end int) {
+	begin = len(n.tokens)
+	for i, v := range n.tokens {
+		if v.Type == Assign || v.Type == Arrow || v.Type == Append {
+			begin = i + 1
+			break
+		}
+	}
+	for begin < len(n.tokens) && n.tokens[begin].Type == WhiteSpace {
+		begin++
+	}
+	end = begin
+	for i := begin; i < len(n.tokens); i++ {
+		switch n.tokens[i].Type {
+		case Comment, NLine:
+			return
+		case WhiteSpace:
+		default:
+			end = i + 1
+		}
+	}
+	return
+}
@@ -0,0 +1,100 @@
+package asteriskconf
+
+import (
+	"bytes"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestPrintCST(t *testing.T) {
+	src, err := ioutil.ReadFile("testdata/modem.conf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	samples := []string{
+		string(src),
+		"",
+		"; only a comment",
+		"[section]\nkey=value",
+		"\n\n  [section] ; header comment\n\tkey = value ; trailing\n\n;-- block\ncomment --;\nfoo=bar\n",
+	}
+	for _, v := range samples {
+		p, err := NewParser(strings.NewReader(v))
+		if err != nil {
+			t.Fatal(err)
+		}
+		a, err := p.Parse()
+		if err != nil {
+			t.Fatal(err)
+		}
+		buf := &bytes.Buffer{}
+		err = PrintCST(buf, a)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if buf.String() != v {
+			t.Errorf("expected %q got %q", v, buf.String())
+		}
+	}
+}
+
+func TestCSTSet(t *testing.T) {
+	src, err := ioutil.ReadFile("testdata/modem.conf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := NewParser(bytes.NewReader(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, err := p.Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	def, err := a.Section("defaults")
+	if err != nil {
+		t.Fatal(err)
+	}
+	def.Set("rxgain", "5")
+	sec, err := a.Section("tigo1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sec.Set("imsi", "640021046580298")
+
+	buf := &bytes.Buffer{}
+	err = PrintCST(buf, a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := strings.Replace(string(src),
+		"rxgain=2                        ; increase",
+		"rxgain=5                        ; increase", 1)
+	expect = strings.Replace(expect,
+		"imei=352215045819420\r\n",
+		"imei=352215045819420\r\nimsi=640021046580298\r\n", 1)
+	if buf.String() != expect {
+		t.Errorf("expected only the edited lines to change got %s", buf)
+	}
+
+	np, err := NewParser(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	na, err := np.Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sec, err = na.Section("tigo1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	v, err := sec.Get("imsi")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v != "640021046580298" {
+		t.Errorf("expected 640021046580298 got %s", v)
+	}
+}
@@ -0,0 +1,277 @@
+package asteriskconf
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// ParseDialplan parses the dialplan read from src, like the contents of
+// extensions.conf.
+func ParseDialplan(src io.Reader) (*File, error) {
+	p, err := NewParser(src)
+	if err != nil {
+		return nil, err
+	}
+	a, err := p.Parse()
+	if err != nil {
+		return nil, err
+	}
+	return NewDialplan(a)
+}
+
+// NewDialplan returns the dialplan defined by the sections of a. Every section
+// is a context, except templates which are returned separately. The definitions
+// that are not under any section are added to the returned *File.
+func NewDialplan(a *Ast) (*File, error) {
+	f := &File{}
+	for _, v := range a.tokens() {
+		if v.Type == Comment {
+			f.Comments = append(f.Comments, tokensNode([]*Token{v}))
+		}
+	}
+	for _, s := range a.Sections {
+		if s.name == "main" && s.tokens == nil {
+			for _, v := range s.values {
+				if v.assign == Arrow {
+					f.Objects = append(f.Objects, newObject(v))
+					continue
+				}
+				f.Assignments = append(f.Assignments, newAsignStmt(v))
+			}
+			continue
+		}
+		c, err := newContext(s)
+		if err != nil {
+			return nil, err
+		}
+		if s.template {
+			f.Templates = append(f.Templates, Template(*c))
+			continue
+		}
+		f.Contexts = append(f.Contexts, *c)
+	}
+	return f, nil
+}
+
+// Context returns the context named name, or nil if there is no such context.
+func (f *File) Context(name string) *Context {
+	for i := range f.Contexts {
+		if f.Contexts[i].Head.Text() == name {
+			return &f.Contexts[i]
+		}
+	}
+	return nil
+}
+
+// Extension returns the extension matching pattern, or nil if the context has
+// no such extension.
+func (c *Context) Extension(pattern string) *Extension {
+	for _, v := range c.Extensions {
+		if v.Pattern.Text() == pattern {
+			return v
+		}
+	}
+	return nil
+}
+
+func newObject(n *NodeIdent) Object {
+	o := Object{
+		Left:   []Node{n.keyNode()},
+		Assign: n.operatorNode(),
+	}
+	if v := n.valueNode(); v != nil {
+		o.Right = []Node{v}
+	}
+	return o
+}
+
+func newAsignStmt(n *NodeIdent) AsignStmt {
+	a := AsignStmt{
+		Left:  []Node{n.keyNode()},
+		Equal: n.operatorNode(),
+	}
+	if v := n.valueNode(); v != nil {
+		a.Right = []Node{v}
+	}
+	return a
+}
+
+func newContext(s *NodeSection) (*Context, error) {
+	c := &Context{
+		Head:      s.headNode(),
+		Templates: s.templateNodes(),
+	}
+	d := &dialplanState{ctx: c}
+	for _, v := range s.values {
+		if v.assign == Arrow {
+			c.Objects = append(c.Objects, newObject(v))
+		} else {
+			c.Assignments = append(c.Assignments, newAsignStmt(v))
+		}
+
+		// asterisk accepts both = and => for the dialplan statements.
+		var err error
+		switch strings.ToLower(v.key) {
+		case "exten":
+			err = d.exten(v, false)
+		case "same":
+			err = d.exten(v, true)
+		case "include":
+			if n := v.valueNode(); n != nil {
+				c.Includes = append(c.Includes, n)
+			}
+		case "switch":
+			if n := v.valueNode(); n != nil {
+				c.Switches = append(c.Switches, n)
+			}
+		}
+		if err != nil {
+			return nil, v.errorf("%v", err)
+		}
+	}
+	return c, nil
+}
+
+// dialplanState keeps track of the last extension line of a context, which is
+// needed to resolve same => lines and the n and s priorities.
+type dialplanState struct {
+	ctx     *Context
+	last    *Extension
+	lastPri int
+}
+
+// exten adds the priority defined by n to the context. When same is true, the
+// value of n has no pattern and the priority is added to the last extension.
+func (d *dialplanState) exten(n *NodeIdent, same bool) error {
+	v := n.valueNode()
+	if v == nil {
+		return fmt.Errorf("missing extension in %s", n.key)
+	}
+	text, begin := v.Text(), v.Begin()
+	ext := d.last
+	if same {
+		if ext == nil {
+			return fmt.Errorf("same without a previous extension")
+		}
+	} else {
+		i := strings.IndexByte(text, ',')
+		if i == -1 {
+			return fmt.Errorf("missing priority in extension %s", text)
+		}
+		pattern := subNode(begin, text[:i])
+		ext = d.ctx.Extension(pattern.Text())
+		if ext == nil {
+			ext = &Extension{Pattern: pattern}
+			d.ctx.Extensions = append(d.ctx.Extensions, ext)
+		}
+		text, begin = text[i+1:], begin+i+1
+	}
+	i := strings.IndexByte(text, ',')
+	if i == -1 {
+		return fmt.Errorf("missing application in extension %s", v.Text())
+	}
+	p := &Priority{Same: same, Line: n.line}
+	pri := text[:i]
+	if j := strings.IndexByte(pri, '('); j != -1 && strings.HasSuffix(pri, ")") {
+		p.Label = subNode(begin+j+1, pri[j+1:len(pri)-1])
+		pri = pri[:j]
+	}
+	p.Priority = subNode(begin, pri)
+	num, err := d.resolve(ext, p.Priority.Text())
+	if err != nil {
+		return err
+	}
+	p.Number = num
+	if num != -1 {
+		d.lastPri = num
+	}
+
+	app, begin := text[i+1:], begin+i+1
+	switch j := strings.IndexAny(app, "(,"); {
+	case j == -1:
+		p.App = subNode(begin, app)
+	case app[j] == '(':
+		p.App = subNode(begin, app[:j])
+		args := strings.TrimSuffix(app[j+1:], ")")
+		if args != "" {
+			p.Args = &textNode{begin: begin + j + 1, text: args}
+		}
+	default:
+		p.App = subNode(begin, app[:j])
+		if args := app[j+1:]; args != "" {
+			p.Args = &textNode{begin: begin + j + 1, text: args}
+		}
+	}
+	ext.Priorities = append(ext.Priorities, p)
+	d.last = ext
+	return nil
+}
+
+// resolve returns the priority number of pri. The priority is either a number,
+// n (next) or s (same) relative to the last priority, a label defined earlier in
+// ext or hint. Except for hint, it can be followed by +offset.
+func (d *dialplanState) resolve(ext *Extension, pri string) (int, error) {
+	if pri == "hint" {
+		return -1, nil
+	}
+	offset := 0
+	if i := strings.IndexByte(pri, '+'); i != -1 {
+		n, err := strconv.Atoi(pri[i+1:])
+		if err != nil {
+			return 0, fmt.Errorf("invalid priority %s", pri)
+		}
+		pri, offset = pri[:i], n
+	}
+	var num int
+	switch pri {
+	case "n", "next":
+		num = d.lastPri + 1
+	case "s", "same":
+		num = d.lastPri
+	default:
+		n, err := strconv.Atoi(pri)
+		if err != nil {
+			n = -1
+			for _, v := range ext.Priorities {
+				if v.Label != nil && v.Label.Text() == pri {
+					n = v.Number
+				}
+			}
+			if n == -1 {
+				return 0, fmt.Errorf("invalid priority %s", pri)
+			}
+		}
+		num = n
+	}
+	num += offset
+	if num < 1 {
+		return 0, fmt.Errorf("invalid priority %s", pri)
+	}
+	return num, nil
+}
+
+// subNode returns a Node for the text s found at offset begin of the source,
+// with the surrounding spaces removed.
+func subNode(begin int, s string) Node {
+	trimmed := strings.TrimLeft(s, " \t")
+	begin += len(s) - len(trimmed)
+	return &textNode{begin: begin, text: strings.TrimRight(trimmed, " \t")}
+}
+
+// errorf returns a *ParseError at the position of the definition.
+func (n *NodeIdent) errorf(format string, args ...interface{}) *ParseError {
+	e := &ParseError{
+		File: n.file,
+		Line: n.line,
+		Msg:  fmt.Sprintf(format, args...),
+	}
+	for _, v := range n.tokens {
+		if v.Type != WhiteSpace {
+			e.Column = v.Column
+			break
+		}
+	}
+	return e
+}
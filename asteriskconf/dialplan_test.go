@@ -0,0 +1,169 @@
+package asteriskconf
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestParseDialplan(t *testing.T) {
+	src := `; generated
+[globals]
+VM_GAIN = 12
+
+[macro-base](!)
+exten => s,1,NoOp
+
+[app-blacklist-check](macro-base)
+include => app-blacklist-check-custom
+exten => s,1(check),GotoIf(blacklisted)
+exten => s,n,Set(CALLED_BLACKLIST=1)
+exten => s,n,Return()
+exten => s,n(blacklisted),Answer
+same => n,Wait(1)
+same => check+10,Hangup
+exten => 100,hint,SIP
+switch => Realtime
+`
+	f, err := ParseDialplan(strings.NewReader(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(f.Comments) != 1 || f.Comments[0].Text() != "; generated" {
+		t.Errorf("expected one comment got %d", len(f.Comments))
+	}
+	if len(f.Templates) != 1 || f.Templates[0].Head.Text() != "macro-base" {
+		t.Fatalf("expected template macro-base got %v", f.Templates)
+	}
+	if len(f.Contexts) != 2 {
+		t.Fatalf("expected 2 contexts got %d", len(f.Contexts))
+	}
+	globals := f.Context("globals")
+	if globals == nil {
+		t.Fatal("expected globals context")
+	}
+	if len(globals.Assignments) != 1 {
+		t.Fatalf("expected one assignment got %d", len(globals.Assignments))
+	}
+	a := globals.Assignments[0]
+	if a.Left[0].Text() != "VM_GAIN" || a.Equal.Text() != "=" || a.Right[0].Text() != "12" {
+		t.Errorf("expected VM_GAIN = 12 got %s %s %s",
+			a.Left[0].Text(), a.Equal.Text(), a.Right[0].Text())
+	}
+
+	c := f.Context("app-blacklist-check")
+	if c == nil {
+		t.Fatal("expected app-blacklist-check context")
+	}
+	if len(c.Templates) != 1 || c.Templates[0].Text() != "macro-base" {
+		t.Errorf("expected template macro-base got %v", c.Templates)
+	}
+	if len(c.Includes) != 1 || c.Includes[0].Text() != "app-blacklist-check-custom" {
+		t.Errorf("expected include app-blacklist-check-custom got %v", c.Includes)
+	}
+	if len(c.Switches) != 1 || c.Switches[0].Text() != "Realtime" {
+		t.Errorf("expected switch Realtime got %v", c.Switches)
+	}
+	if len(c.Objects) != 9 {
+		t.Errorf("expected 9 objects got %d", len(c.Objects))
+	}
+	if len(c.Extensions) != 2 {
+		t.Fatalf("expected 2 extensions got %d", len(c.Extensions))
+	}
+	expect := []struct {
+		number      int
+		label, app  string
+		args        string
+		same        bool
+		hasLabel    bool
+		hasArgs     bool
+		priorityTxt string
+	}{
+		{1, "check", "GotoIf", "blacklisted", false, true, true, "1"},
+		{2, "", "Set", "CALLED_BLACKLIST=1", false, false, true, "n"},
+		{3, "", "Return", "", false, false, false, "n"},
+		{4, "blacklisted", "Answer", "", false, true, false, "n"},
+		{5, "", "Wait", "1", true, false, true, "n"},
+		{11, "", "Hangup", "", true, false, false, "check+10"},
+	}
+	s := c.Extension("s")
+	if s == nil {
+		t.Fatal("expected extension s")
+	}
+	if len(s.Priorities) != len(expect) {
+		t.Fatalf("expected %d priorities got %d", len(expect), len(s.Priorities))
+	}
+	for i, v := range expect {
+		p := s.Priorities[i]
+		if p.Number != v.number {
+			t.Errorf("expected priority %d got %d", v.number, p.Number)
+		}
+		if p.Priority.Text() != v.priorityTxt {
+			t.Errorf("expected priority text %s got %s", v.priorityTxt, p.Priority.Text())
+		}
+		if p.Same != v.same {
+			t.Errorf("expected same %v got %v", v.same, p.Same)
+		}
+		if (p.Label != nil) != v.hasLabel || (p.Label != nil && p.Label.Text() != v.label) {
+			t.Errorf("expected label %q got %v", v.label, p.Label)
+		}
+		if p.App.Text() != v.app {
+			t.Errorf("expected application %s got %s", v.app, p.App.Text())
+		}
+		if (p.Args != nil) != v.hasArgs || (p.Args != nil && p.Args.Text() != v.args) {
+			t.Errorf("expected arguments %q got %v", v.args, p.Args)
+		}
+		for _, n := range []Node{p.Priority, p.Label, p.App, p.Args} {
+			if n != nil && src[n.Begin():n.End()] != n.Text() {
+				t.Errorf("expected %s at %d got %s", n.Text(), n.Begin(), src[n.Begin():n.End()])
+			}
+		}
+	}
+	hint := c.Extension("100")
+	if hint == nil || len(hint.Priorities) != 1 {
+		t.Fatal("expected hint extension")
+	}
+	if hint.Priorities[0].Number != -1 || hint.Priorities[0].App.Text() != "SIP" {
+		t.Errorf("expected hint SIP got %d %s", hint.Priorities[0].Number, hint.Priorities[0].App.Text())
+	}
+
+	bad := []string{
+		"[ctx]\nsame => n,NoOp\n",
+		"[ctx]\nexten => s\n",
+		"[ctx]\nexten => s,1\n",
+		"[ctx]\nexten => s,foo,NoOp\n",
+	}
+	for _, v := range bad {
+		_, err = ParseDialplan(strings.NewReader(v))
+		if err == nil {
+			t.Errorf("expected an error for %q", v)
+		}
+	}
+}
+
+func TestParseDialplanFile(t *testing.T) {
+	f, err := os.Open("../extensions_additional.conf.fastc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	d, err := ParseDialplan(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := d.Context("app-blacklist-check")
+	if c == nil {
+		t.Fatal("expected app-blacklist-check context")
+	}
+	s := c.Extension("s")
+	if s == nil || len(s.Priorities) != 8 {
+		t.Fatal("expected extension s with 8 priorities")
+	}
+	p := s.Priorities[0]
+	if p.App.Text() != "GotoIf" || p.Args.Text() != `$["${BLACKLIST()}"="1"]?blacklisted` {
+		t.Errorf("expected GotoIf got %s(%s)", p.App.Text(), p.Args.Text())
+	}
+	if p = s.Priorities[3]; p.Number != 4 || p.Label.Text() != "blacklisted" {
+		t.Errorf("expected priority 4 labelled blacklisted got %d", p.Number)
+	}
+}
@@ -0,0 +1,8 @@
+// Package asteriskconf parses, edits and prints asterisk configuration files.
+//
+// The Parser turns a configuration file into an *Ast of sections and
+// definitions, keeping the comments and white space of the input so that the
+// Ast can be written back with PrintCST without losing the formatting. Files
+// with #include directives are parsed with ParseFile, and dialplans like
+// extensions.conf can be read into contexts and extensions with ParseDialplan.
+package asteriskconf
@@ -0,0 +1,503 @@
+package asteriskconf
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// SetValue sets the value of the first definition of key in section to value,
+// adding the definition at the end of the section if there is none. See
+// NodeSection.Set.
+func (a *Ast) SetValue(section, key, value string) error {
+	sec, err := a.Section(section)
+	if err != nil {
+		return err
+	}
+	return sec.Set(key, value)
+}
+
+// SetValueAt sets the value of the definition number i of key in section,
+// counting from 0 in the order they appear. When i is the number of
+// definitions, a new definition is added right after the last one, or at the
+// end of the section if there is none.
+func (a *Ast) SetValueAt(section, key string, i int, value string) error {
+	sec, err := a.Section(section)
+	if err != nil {
+		return err
+	}
+	defs := sec.definitions(key)
+	if i < 0 || i > len(defs) {
+		return fmt.Errorf("index %d out of range, section %s has %d definitions of %s",
+			i, section, len(defs), key)
+	}
+	if err = checkValue(key, value); err != nil {
+		return err
+	}
+	if i < len(defs) {
+		defs[i].node().setValue(value)
+		return nil
+	}
+	if len(defs) == 0 {
+		return sec.Set(key, value)
+	}
+	last := defs[len(defs)-1]
+	sec, at := last.sec, last.i+1
+	n := &NodeIdent{key: key, value: value, assign: last.node().assign}
+	sec.values = append(sec.values[:at:at], append([]*NodeIdent{n}, sec.values[at:]...)...)
+	for _, d := range sec.directives {
+		if d.at >= at {
+			d.at++
+		}
+	}
+	return nil
+}
+
+// DeleteKey removes all the definitions of key from section.
+//
+// The comment lines right above a removed definition, and its trailing comment,
+// are removed with it. Other comments and blank lines are left in place.
+func (a *Ast) DeleteKey(section, key string) error {
+	return a.deleteKey(section, key, -1)
+}
+
+// DeleteKeyAt removes the definition number i of key from section, counting
+// from 0 in the order they appear. Comments are removed like with DeleteKey.
+func (a *Ast) DeleteKeyAt(section, key string, i int) error {
+	if i < 0 {
+		return fmt.Errorf("index %d out of range", i)
+	}
+	return a.deleteKey(section, key, i)
+}
+
+// deleteKey removes the definition number only of key from section, or all of
+// them when only is -1.
+func (a *Ast) deleteKey(section, key string, only int) error {
+	sec, err := a.Section(section)
+	if err != nil {
+		return err
+	}
+	defs := sec.definitions(key)
+	if len(defs) == 0 {
+		return fmt.Errorf("key %s not found in section %s", key, section)
+	}
+	if only >= len(defs) {
+		return fmt.Errorf("index %d out of range, section %s has %d definitions of %s",
+			only, section, len(defs), key)
+	}
+	for n := len(defs) - 1; n >= 0; n-- {
+		if only != -1 && n != only {
+			continue
+		}
+		sec, i := defs[n].sec, defs[n].i
+		v := sec.values[i]
+		a.detach(&v.lead, v.tokens, v.file, func() {
+			sec.values = append(sec.values[:i:i], sec.values[i+1:]...)
+			for _, d := range sec.directives {
+				if d.at > i {
+					d.at--
+				}
+			}
+		})
+	}
+	return nil
+}
+
+// keyDef is the definition at index i of the values of sec.
+type keyDef struct {
+	sec *NodeSection
+	i   int
+}
+
+func (d keyDef) node() *NodeIdent {
+	return d.sec.values[d.i]
+}
+
+// definitions returns the definitions of key in n and in the sections
+// appending to it, in the order they appear.
+func (n *NodeSection) definitions(key string) []keyDef {
+	var o []keyDef
+	for _, sec := range append([]*NodeSection{n}, n.appended...) {
+		for i, v := range sec.values {
+			if v.key == key {
+				o = append(o, keyDef{sec, i})
+			}
+		}
+	}
+	return o
+}
+
+// AddSection adds sec at the end of the Ast. The section header is printed by
+// PrintCST after a blank line, and it is an error to add a section whose name is
+// already used.
+func (a *Ast) AddSection(sec *NodeSection) error {
+	if err := checkName(sec.name); err != nil {
+		return err
+	}
+	if a.index(sec.name) != -1 {
+		return fmt.Errorf("section %s already exists", sec.name)
+	}
+	sec.file = a.file
+	sec.tokens = sec.header(a.newline())
+	a.appendSection(sec, nil)
+	return nil
+}
+
+// RemoveSection removes the section named name together with its definitions
+// and directives, and the sections appending to it.
+//
+// The comment lines right above the section headers are removed with them.
+// Other comments and blank lines are left in place.
+func (a *Ast) RemoveSection(name string) error {
+	i, err := a.editable(name)
+	if err != nil {
+		return err
+	}
+	base := a.Sections[i]
+	for _, sec := range append(append([]*NodeSection(nil), base.appended...), base) {
+		sec := sec
+		a.detach(&sec.lead, sec.tokens, sec.file, func() {
+			for i, v := range a.Sections {
+				if v == sec {
+					a.Sections = append(a.Sections[:i:i], a.Sections[i+1:]...)
+					break
+				}
+			}
+		})
+	}
+	return nil
+}
+
+// RenameSection renames the section named old to name, and updates the
+// sections appending to it and inheriting from it. Only the names in the section headers are
+// changed, the options and comments of the headers are kept.
+func (a *Ast) RenameSection(old, name string) error {
+	i, err := a.editable(old)
+	if err != nil {
+		return err
+	}
+	if err = checkName(name); err != nil {
+		return err
+	}
+	if a.index(name) != -1 {
+		return fmt.Errorf("section %s already exists", name)
+	}
+	a.Sections[i].rename(name)
+	for _, v := range a.Sections[i].appended {
+		v.rename(name)
+	}
+	for _, v := range a.Sections {
+		v.renameTemplate(old, name)
+	}
+	return nil
+}
+
+// MoveSection moves the section named name before the section named before, or
+// to the end of the Ast when before is empty.
+//
+// The section is moved with its definitions and the comment lines right above
+// its header. The blank lines between the sections are kept as they were.
+func (a *Ast) MoveSection(name, before string) error {
+	i, err := a.editable(name)
+	if err != nil {
+		return err
+	}
+	sec := a.Sections[i]
+	if len(sec.appended) > 0 || sec.appends {
+		return fmt.Errorf("section %s is appended to with (+), it can not be moved", name)
+	}
+	var next *NodeSection
+	if before != "" {
+		j, err := a.editable(before)
+		if err != nil {
+			return err
+		}
+		next = a.Sections[j]
+		if next == sec {
+			return nil
+		}
+		if next.file != sec.file {
+			return fmt.Errorf("sections %s and %s are not in the same file", name, before)
+		}
+	}
+	keep, attached := splitLead(sec.lead)
+	a.detach(&sec.lead, sec.tokens, sec.file, func() {
+		a.Sections = append(a.Sections[:i:i], a.Sections[i+1:]...)
+	})
+	if next == nil {
+		a.appendSection(sec, attached)
+		return nil
+	}
+	nextKeep, nextAttached := splitLead(next.lead)
+	blank := blankLines(nextKeep)
+	if len(blank) == 0 {
+		blank = blankLines(keep)
+	}
+	sec.lead = concatTokens(nextKeep, attached)
+	next.lead = concatTokens(blank, nextAttached)
+	j := a.index(before)
+	a.Sections = append(a.Sections[:j:j], append([]*NodeSection{sec}, a.Sections[j:]...)...)
+	return nil
+}
+
+// index returns the index of the section named name in the Ast, or -1 if there
+// is no such section.
+func (a *Ast) index(name string) int {
+	for i, v := range a.Sections {
+		if v.name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// editable returns the index of the section named name, or an error if there is
+// no such section or it is the main section, which has no header.
+func (a *Ast) editable(name string) (int, error) {
+	i := a.index(name)
+	if i == -1 {
+		return -1, fmt.Errorf("section %s not found", name)
+	}
+	if sec := a.Sections[i]; sec.name == "main" && sec.tokens == nil {
+		return -1, errors.New("the main section can not be edited")
+	}
+	return i, nil
+}
+
+// checkName returns an error if name can not be used as a section name.
+func checkName(name string) error {
+	if strings.TrimSpace(name) != name || name == "" ||
+		strings.ContainsAny(name, "[]\r\n;") {
+		return fmt.Errorf("invalid section name %q", name)
+	}
+	return nil
+}
+
+// detach calls remove to take the node with lead and toks out of the Ast. The
+// comment lines right above the node are dropped, and the other lines of its
+// lead are moved to the node that is printed after it.
+func (a *Ast) detach(lead *[]*Token, toks []*Token, file string, remove func()) {
+	leads := a.leads(file)
+	k := -1
+	for i, v := range leads {
+		if v == lead {
+			k = i
+			break
+		}
+	}
+	remove()
+	if k == -1 {
+
+		// the node is not printed, there is nothing to move
+		return
+	}
+	keep, _ := splitLead(*lead)
+	if leads = a.leads(file); k < len(leads) {
+		*leads[k] = joinLead(keep, *leads[k])
+		return
+	}
+	if file != a.file {
+		return
+	}
+	if len(a.trail) == 0 {
+		keep = keep[:len(keep)-len(blankLines(keep))]
+	}
+	a.trail = joinLead(keep, a.trail)
+}
+
+// leads returns the leads of the nodes that PrintCST writes for file, in the
+// order they are written.
+func (a *Ast) leads(file string) []*[]*Token {
+	var o []*[]*Token
+	a.walk(func(lead *[]*Token, toks []*Token, f string) {
+		if toks != nil && f == file {
+			o = append(o, lead)
+		}
+	})
+	return o
+}
+
+// appendSection adds sec after the last section, attached being the comment
+// lines printed right above its header. The section is separated from what is
+// printed before it by a blank line.
+func (a *Ast) appendSection(sec *NodeSection, attached []*Token) {
+	nl := &Token{Type: NLine, Text: a.newline()}
+	var buf bytes.Buffer
+	_ = PrintCST(&buf, a)
+	lead := a.trail
+	a.trail = nil
+	if out := strings.TrimRight(buf.String(), " \t"); out != "" {
+		if !strings.HasSuffix(out, "\n") && !strings.HasSuffix(out, "\r") {
+			lead = concatTokens(lead, []*Token{nl})
+			out += nl.Text
+		}
+		out = strings.TrimRight(strings.TrimSuffix(out, nl.Text), " \t")
+		if i := strings.LastIndexAny(out, "\r\n"); out != "" && i != len(out)-1 {
+			lead = concatTokens(lead, []*Token{nl})
+		}
+	}
+	sec.lead = concatTokens(lead, attached)
+	a.Sections = append(a.Sections, sec)
+}
+
+// header returns the tokens of the header line of the section, ending with the
+// new line nl.
+func (n *NodeSection) header(nl string) []*Token {
+	toks := []*Token{
+		{Type: LBrace, Text: "["},
+		{Type: Ident, Text: n.name},
+		{Type: RBrace, Text: "]"},
+	}
+	var opts []*Token
+	if n.template {
+		opts = append(opts, &Token{Type: Exclam, Text: "!"})
+	}
+	for _, v := range n.inherits {
+		if len(opts) > 0 {
+			opts = append(opts, &Token{Type: Comma, Text: ","})
+		}
+		opts = append(opts, &Token{Type: Ident, Text: v})
+	}
+	if len(opts) > 0 {
+		toks = append(toks, &Token{Type: LBracket, Text: "("})
+		toks = append(toks, opts...)
+		toks = append(toks, &Token{Type: RBracket, Text: ")"})
+	}
+	return append(toks, &Token{Type: NLine, Text: nl})
+}
+
+// rename changes the name of the section and the name in its header.
+func (n *NodeSection) rename(name string) {
+	n.name = name
+	begin, end := -1, -1
+	for i, v := range n.tokens {
+		if v.Type == LBrace && begin == -1 {
+			begin = i + 1
+		}
+		if v.Type == RBrace {
+			end = i
+			break
+		}
+	}
+	if begin == -1 || end == -1 {
+		return
+	}
+	for begin < end && n.tokens[begin].Type == WhiteSpace {
+		begin++
+	}
+	for end > begin && n.tokens[end-1].Type == WhiteSpace {
+		end--
+	}
+	tok := &Token{Type: Ident, Text: name, Line: n.line}
+	if begin < len(n.tokens) {
+		tok.Begin = n.tokens[begin].Begin
+		tok.Column = n.tokens[begin].Column
+	}
+	toks := make([]*Token, 0, len(n.tokens))
+	toks = append(toks, n.tokens[:begin]...)
+	toks = append(toks, tok)
+	n.tokens = append(toks, n.tokens[end:]...)
+}
+
+// renameTemplate replaces the template old with name in the templates the
+// section inherits from.
+func (n *NodeSection) renameTemplate(old, name string) {
+	found := false
+	for i, v := range n.inherits {
+		if v == old {
+			n.inherits[i] = name
+			found = true
+		}
+	}
+	if !found || n.tokens == nil {
+		return
+	}
+	toks := make([]*Token, len(n.tokens))
+	copy(toks, n.tokens)
+	options := false
+	for i, v := range toks {
+		switch {
+		case v.Type == RBrace:
+			options = true
+		case options && v.Type == Ident && v.Text == old:
+			tok := *v
+			tok.Text = name
+			toks[i] = &tok
+		}
+	}
+	n.tokens = toks
+}
+
+// lines splits toks into lines. Every line ends with a new line token, except
+// the last one when toks does not end with a new line.
+func lines(toks []*Token) [][]*Token {
+	var o [][]*Token
+	begin := 0
+	for i, v := range toks {
+		if v.Type == NLine {
+			o = append(o, toks[begin:i+1:i+1])
+			begin = i + 1
+		}
+	}
+	if begin < len(toks) {
+		o = append(o, toks[begin:len(toks):len(toks)])
+	}
+	return o
+}
+
+// isBlank returns true if line has only white space.
+func isBlank(line []*Token) bool {
+	for _, v := range line {
+		if v.Type != WhiteSpace && v.Type != NLine {
+			return false
+		}
+	}
+	return true
+}
+
+// splitLead splits the lead of a node into the lines to keep when the node is
+// removed, and the comment lines right above the node.
+func splitLead(lead []*Token) (keep, attached []*Token) {
+	ls := lines(lead)
+	n := 0
+	for i := len(ls) - 1; i >= 0 && !isBlank(ls[i]); i-- {
+		n += len(ls[i])
+	}
+	return lead[: len(lead)-n : len(lead)-n], lead[len(lead)-n:]
+}
+
+// blankLines returns the blank lines at the end of toks.
+func blankLines(toks []*Token) []*Token {
+	ls := lines(toks)
+	n := 0
+	for i := len(ls) - 1; i >= 0 && isBlank(ls[i]); i-- {
+		n += len(ls[i])
+	}
+	return toks[len(toks)-n:]
+}
+
+// joinLead returns the lines of a followed by the lines of b. The blank lines
+// where they meet are not repeated, only the longest run of them is kept.
+func joinLead(a, b []*Token) []*Token {
+	ls := lines(b)
+	n, lb := 0, 0
+	for _, v := range ls {
+		if !isBlank(v) {
+			break
+		}
+		n++
+		lb += len(v)
+	}
+	if la := len(lines(blankLines(a))); la > n {
+		return concatTokens(a, b[lb:])
+	}
+	return concatTokens(a[:len(a)-len(blankLines(a))], b)
+}
+
+// concatTokens returns a new slice holding the tokens of a followed by b.
+func concatTokens(a, b []*Token) []*Token {
+	o := make([]*Token, 0, len(a)+len(b))
+	o = append(o, a...)
+	return append(o, b...)
+}
@@ -0,0 +1,276 @@
+package asteriskconf
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestAstEdit(t *testing.T) {
+	src := `; dongles managed by fastc
+
+[defaults](!)
+context=default ; the default context
+rxgain=2
+
+; the first modem
+[airtel1](defaults)
+; where it is plugged
+audio=/dev/ttyUSB1
+imei=353220047976425
+
+[tigo1](defaults)
+imei=352215045819420
+`
+	sample := []struct {
+		name   string
+		edit   func(a *Ast) error
+		expect string
+	}{
+		{
+			"set value",
+			func(a *Ast) error {
+				return a.SetValue("defaults", "context", "from-trunk")
+			},
+			strings.Replace(src, "context=default ;", "context=from-trunk ;", 1),
+		},
+		{
+			"set new key",
+			func(a *Ast) error {
+				return a.SetValue("tigo1", "imsi", "640021046580298")
+			},
+			src + "imsi=640021046580298\n",
+		},
+		{
+			"delete key",
+			func(a *Ast) error {
+				return a.DeleteKey("airtel1", "audio")
+			},
+			strings.Replace(src, "; where it is plugged\naudio=/dev/ttyUSB1\n", "", 1),
+		},
+		{
+			"set value at index",
+			func(a *Ast) error {
+				return a.SetValueAt("airtel1", "imei", 0, "353220047976426")
+			},
+			strings.Replace(src, "imei=353220047976425", "imei=353220047976426", 1),
+		},
+		{
+			"add value at index",
+			func(a *Ast) error {
+				return a.SetValueAt("airtel1", "audio", 1, "/dev/ttyUSB4")
+			},
+			strings.Replace(src, "audio=/dev/ttyUSB1\n", "audio=/dev/ttyUSB1\naudio=/dev/ttyUSB4\n", 1),
+		},
+		{
+			"delete key at index",
+			func(a *Ast) error {
+				if err := a.SetValueAt("airtel1", "audio", 1, "/dev/ttyUSB4"); err != nil {
+					return err
+				}
+				return a.DeleteKeyAt("airtel1", "audio", 0)
+			},
+			strings.Replace(src, "; where it is plugged\naudio=/dev/ttyUSB1\n", "audio=/dev/ttyUSB4\n", 1),
+		},
+		{
+			"add section",
+			func(a *Ast) error {
+				sec := NewSection("vodacom1", "defaults")
+				sec.Add(NewIdent("imei", "359000000000001"))
+				return a.AddSection(sec)
+			},
+			src + "\n[vodacom1](defaults)\nimei=359000000000001\n",
+		},
+		{
+			"remove section",
+			func(a *Ast) error {
+				return a.RemoveSection("airtel1")
+			},
+			strings.Replace(src, `; the first modem
+[airtel1](defaults)
+; where it is plugged
+audio=/dev/ttyUSB1
+imei=353220047976425
+
+`, "", 1),
+		},
+		{
+			"remove last section",
+			func(a *Ast) error {
+				return a.RemoveSection("tigo1")
+			},
+			strings.Replace(src, "\n[tigo1](defaults)\nimei=352215045819420\n", "", 1),
+		},
+		{
+			"rename section",
+			func(a *Ast) error {
+				return a.RenameSection("defaults", "dongle")
+			},
+			strings.Replace(src, "defaults", "dongle", -1),
+		},
+		{
+			"move section",
+			func(a *Ast) error {
+				return a.MoveSection("tigo1", "airtel1")
+			},
+			`; dongles managed by fastc
+
+[defaults](!)
+context=default ; the default context
+rxgain=2
+
+[tigo1](defaults)
+imei=352215045819420
+
+; the first modem
+[airtel1](defaults)
+; where it is plugged
+audio=/dev/ttyUSB1
+imei=353220047976425
+`,
+		},
+		{
+			"move section to the end",
+			func(a *Ast) error {
+				return a.MoveSection("airtel1", "")
+			},
+			`; dongles managed by fastc
+
+[defaults](!)
+context=default ; the default context
+rxgain=2
+
+[tigo1](defaults)
+imei=352215045819420
+
+; the first modem
+[airtel1](defaults)
+; where it is plugged
+audio=/dev/ttyUSB1
+imei=353220047976425
+`,
+		},
+	}
+	for _, v := range sample {
+		p, err := NewParser(strings.NewReader(src))
+		if err != nil {
+			t.Fatal(err)
+		}
+		a, err := p.Parse()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = v.edit(a); err != nil {
+			t.Errorf("%s: %v", v.name, err)
+			continue
+		}
+		var buf bytes.Buffer
+		if err = PrintCST(&buf, a); err != nil {
+			t.Fatal(err)
+		}
+		if buf.String() != v.expect {
+			t.Errorf("%s: expected\n%s\ngot\n%s", v.name, v.expect, buf.String())
+		}
+	}
+}
+
+func TestAstEditAppend(t *testing.T) {
+	src := "[a]\nx=1\n[b]\ny=2\n[a](+)\nx=3\nz=4\n"
+	sample := []struct {
+		name   string
+		edit   func(a *Ast) error
+		expect string
+	}{
+		{
+			"set appended value",
+			func(a *Ast) error {
+				return a.SetValue("a", "z", "5")
+			},
+			"[a]\nx=1\n[b]\ny=2\n[a](+)\nx=3\nz=5\n",
+		},
+		{
+			"add value after the appended ones",
+			func(a *Ast) error {
+				return a.SetValueAt("a", "x", 2, "6")
+			},
+			"[a]\nx=1\n[b]\ny=2\n[a](+)\nx=3\nx=6\nz=4\n",
+		},
+		{
+			"delete key",
+			func(a *Ast) error {
+				return a.DeleteKey("a", "x")
+			},
+			"[a]\n[b]\ny=2\n[a](+)\nz=4\n",
+		},
+		{
+			"rename section",
+			func(a *Ast) error {
+				return a.RenameSection("a", "c")
+			},
+			"[c]\nx=1\n[b]\ny=2\n[c](+)\nx=3\nz=4\n",
+		},
+		{
+			"remove section",
+			func(a *Ast) error {
+				return a.RemoveSection("a")
+			},
+			"[b]\ny=2\n",
+		},
+	}
+	for _, v := range sample {
+		p, err := NewParser(strings.NewReader(src))
+		if err != nil {
+			t.Fatal(err)
+		}
+		a, err := p.Parse()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = v.edit(a); err != nil {
+			t.Errorf("%s: %v", v.name, err)
+			continue
+		}
+		var buf bytes.Buffer
+		if err = PrintCST(&buf, a); err != nil {
+			t.Fatal(err)
+		}
+		if buf.String() != v.expect {
+			t.Errorf("%s: expected\n%s\ngot\n%s", v.name, v.expect, buf.String())
+		}
+	}
+}
+
+func TestAstEditErrors(t *testing.T) {
+	p, err := NewParser(strings.NewReader("top=1\n[a]\nx=1\n[b]\ny=2\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, err := p.Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	errs := []error{
+		a.SetValue("c", "x", "1"),
+		a.DeleteKey("a", "y"),
+		a.SetValueAt("a", "x", 2, "1"),
+		a.DeleteKeyAt("a", "x", 1),
+		a.SetValue("a", "x", "1\n[evil]"),
+		a.SetValueAt("a", "x", 1, "1\r\n"),
+		a.AddSection(NewSection("b")),
+		a.AddSection(NewSection("bad]name")),
+		a.RemoveSection("main"),
+		a.RenameSection("a", "b"),
+		a.MoveSection("a", "c"),
+	}
+	for i, v := range errs {
+		if v == nil {
+			t.Errorf("expected an error for edit %d", i)
+		}
+	}
+	sec := NewSection("c")
+	sec.Add(NewIdent("x", "1\n[evil]"))
+	a.Sections = append(a.Sections, sec)
+	if err = PrintCST(&bytes.Buffer{}, a); err == nil {
+		t.Error("expected an error printing a value with a new line")
+	}
+}
@@ -0,0 +1,95 @@
+package asteriskconf
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ParseError is an error found while parsing the input, at the position of the
+// offending token.
+type ParseError struct {
+	File   string
+	Line   int
+	Column int
+
+	// Token is the offending token and Expected are the token types that would
+	// have been valid in its place. Msg describes the error when it is not about
+	// an unexpected token.
+	Token    *Token
+	Expected []TokenType
+	Msg      string
+}
+
+// newParseError returns a *ParseError for the unexpected token tok.
+func newParseError(tok *Token, expected ...TokenType) *ParseError {
+	return &ParseError{
+		Line:     tok.Line,
+		Column:   tok.Column,
+		Token:    tok,
+		Expected: expected,
+	}
+}
+
+func (e *ParseError) Error() string {
+	pos := fmt.Sprintf("%d:%d", e.Line, e.Column)
+	if e.File != "" {
+		pos = e.File + ":" + pos
+	}
+	if e.Msg != "" {
+		return pos + ": " + e.Msg
+	}
+	msg := pos + ": unexpected " + describeToken(e.Token)
+	if len(e.Expected) > 0 {
+		var expected []string
+		for _, v := range e.Expected {
+			expected = append(expected, v.String())
+		}
+		msg += ", expected " + strings.Join(expected, " or ")
+	}
+	return msg
+}
+
+// describeToken returns the description of tok used in error messages.
+func describeToken(tok *Token) string {
+	if tok == nil {
+		return "token"
+	}
+	switch tok.Type {
+	case Ident, Value, Directive, Illegal:
+		return fmt.Sprintf("%s %q", tok.Type, tok.Text)
+	}
+	return tok.Type.String()
+}
+
+// ErrorList is a list of parse errors. It is returned by Parser.Parse when the
+// parser is set to report all errors.
+type ErrorList []*ParseError
+
+func (e ErrorList) Error() string {
+	switch len(e) {
+	case 0:
+		return "no errors"
+	case 1:
+		return e[0].Error()
+	}
+	var msg []string
+	for _, v := range e {
+		msg = append(msg, v.Error())
+	}
+	return strings.Join(msg, "\n")
+}
+
+// setFile sets the file name of err if it is a parse error without one.
+func setFile(err error, file string) error {
+	switch e := err.(type) {
+	case *ParseError:
+		if e.File == "" {
+			e.File = file
+		}
+	case ErrorList:
+		for _, v := range e {
+			setFile(v, file)
+		}
+	}
+	return err
+}
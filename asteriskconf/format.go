@@ -0,0 +1,200 @@
+package asteriskconf
+
+import (
+	"io"
+	"strings"
+	"unicode"
+)
+
+// FormatOptions are the choices of Format. The zero value writes definitions as
+// key=value, with a single space before trailing comments, and keeps the blank
+// lines between sections.
+type FormatOptions struct {
+	// Spaces writes the operators of definitions surrounded by spaces, as in
+	// key = value.
+	Spaces bool
+
+	// AlignComments aligns the trailing comments of consecutive lines in a
+	// column. Blank lines and comment lines start a new block of lines.
+	AlignComments bool
+
+	// SectionLines puts exactly one blank line before each section header, or
+	// before the comment lines right above it.
+	SectionLines bool
+}
+
+// formatLine is a line written by Format. code is the section header,
+// definition or directive of the line, comment its trailing comment, or the
+// whole line when code is empty. A line with neither is a blank line.
+type formatLine struct {
+	code    string
+	comment string
+	header  bool
+}
+
+func (l *formatLine) blank() bool {
+	return l.code == "" && l.comment == ""
+}
+
+// Format writes src to dst in the canonical format of opts. The comments and
+// the order of the sections, definitions and directives are kept, but the white
+// space is rewritten. Lines have no trailing white space, only comment lines
+// are indented, the definitions are written as set by opts.Spaces, and runs of
+// blank lines are collapsed into one with none at the beginning and the end of
+// the output.
+//
+// Like PrintCST, only the parts of src that belong to the parsed file are
+// written, the content of included files is left out.
+func Format(dst io.Writer, src *Ast, opts FormatOptions) error {
+	f := &formatter{opts: opts}
+	for _, v := range src.Sections {
+		if v.tokens != nil {
+			if v.file == src.file {
+				f.lead(v.lead)
+				f.node(v.tokens, "["+v.name+"]"+v.options(), true)
+			}
+		} else if v.name != "main" {
+			f.node(nil, "["+v.name+"]"+v.options(), true)
+		}
+		d := v.directives
+		for i, sub := range v.values {
+			for ; len(d) > 0 && d[0].at <= i; d = d[1:] {
+				f.directive(src, d[0])
+			}
+			if sub.tokens != nil && sub.file != src.file {
+				continue
+			}
+			if err := checkValue(sub.key, sub.value); err != nil {
+				return err
+			}
+			f.lead(sub.lead)
+			f.node(sub.tokens, f.definition(sub), false)
+		}
+		for _, sub := range d {
+			f.directive(src, sub)
+		}
+	}
+	f.lead(src.trail)
+	return f.write(dst, src.newline())
+}
+
+type formatter struct {
+	opts  FormatOptions
+	lines []*formatLine
+}
+
+// lead adds the comment and blank lines of toks. The indentation of comment
+// lines is kept, it is often used to continue the trailing comment of the line
+// above.
+func (f *formatter) lead(toks []*Token) {
+	for _, line := range lines(toks) {
+		l := &formatLine{}
+		if !isBlank(line) {
+			for _, v := range line {
+				l.comment += v.Text
+			}
+		}
+		l.comment = strings.TrimRightFunc(l.comment, unicode.IsSpace)
+		f.lines = append(f.lines, l)
+	}
+}
+
+// node adds the line of a section header, definition or directive, with the
+// trailing comment found in its tokens.
+func (f *formatter) node(toks []*Token, code string, header bool) {
+	l := &formatLine{code: code, header: header}
+	for _, v := range toks {
+		if v.Type == Comment {
+			l.comment += v.Text
+		}
+	}
+	l.comment = strings.TrimRightFunc(l.comment, unicode.IsSpace)
+	f.lines = append(f.lines, l)
+}
+
+func (f *formatter) directive(src *Ast, d *NodeDirective) {
+	if d.tokens == nil {
+		f.node(nil, "#"+d.name+" "+d.arg, false)
+		return
+	}
+	if d.file != src.file {
+		return
+	}
+	f.lead(d.lead)
+	code := ""
+	for _, v := range d.tokens {
+		if v.Type == Directive {
+			code = strings.TrimSpace(v.Text)
+		}
+	}
+	f.node(d.tokens, code, false)
+}
+
+// definition returns the definition n as it is written by Format.
+func (f *formatter) definition(n *NodeIdent) string {
+	value := escapeValue(n.value)
+	if !f.opts.Spaces {
+		return n.key + n.Operator() + value
+	}
+	return strings.TrimRightFunc(n.key+" "+n.Operator()+" "+value, unicode.IsSpace)
+}
+
+// write writes the lines of f to dst, after fixing the blank lines and the
+// column of the trailing comments.
+func (f *formatter) write(dst io.Writer, nl string) error {
+	ls := f.spaced()
+	width := make([]int, len(ls))
+	for begin := 0; begin < len(ls); {
+		end := begin + 1
+		if f.opts.AlignComments && ls[begin].code != "" {
+			for end < len(ls) && ls[end].code != "" {
+				end++
+			}
+		}
+		w := 0
+		for _, v := range ls[begin:end] {
+			if v.comment != "" && len(v.code) > w {
+				w = len(v.code)
+			}
+		}
+		for i := begin; i < end; i++ {
+			width[i] = w
+		}
+		begin = end
+	}
+	p := &cstPrinter{w: dst, nl: nl}
+	for i, v := range ls {
+		s := v.code
+		if v.code != "" && v.comment != "" {
+			s += strings.Repeat(" ", width[i]-len(v.code)+1)
+		}
+		p.line(s + v.comment)
+	}
+	return p.err
+}
+
+// spaced returns the lines of f with the runs of blank lines collapsed, and the
+// blank lines before the sections set when opts.SectionLines is true.
+func (f *formatter) spaced() []*formatLine {
+	var o []*formatLine
+	for _, v := range f.lines {
+		if v.blank() && (len(o) == 0 || o[len(o)-1].blank()) {
+			continue
+		}
+		if v.header && f.opts.SectionLines {
+			// the comment lines right above the header stay attached to it.
+			at := len(o)
+			for at > 0 && o[at-1].code == "" && !o[at-1].blank() {
+				at--
+			}
+			if at > 0 && !o[at-1].blank() {
+				o = append(o[:at], append([]*formatLine{{}}, o[at:]...)...)
+			}
+		}
+		o = append(o, v)
+	}
+	for len(o) > 0 && o[len(o)-1].blank() {
+		o = o[:len(o)-1]
+	}
+	return o
+}
@@ -0,0 +1,172 @@
+package asteriskconf
+
+import (
+	"bytes"
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestFormat(t *testing.T) {
+	src := `
+
+; dongles managed by fastc
+[defaults](!)
+context = default ; the default context
+rxgain=2;gain
+  exten=>s,1,Answer()
+
+
+; the first modem
+[airtel1](defaults)
+	; where it is plugged
+audio=/dev/ttyUSB1
+#include "airtel.conf"   ; extra options
+imei=353220047976425
+[tigo1] (defaults)
+
+`
+	sample := []struct {
+		name   string
+		opts   FormatOptions
+		expect string
+	}{
+		{
+			"default",
+			FormatOptions{},
+			`; dongles managed by fastc
+[defaults](!)
+context=default ; the default context
+rxgain=2 ;gain
+exten=>s,1,Answer()
+
+; the first modem
+[airtel1](defaults)
+	; where it is plugged
+audio=/dev/ttyUSB1
+#include "airtel.conf" ; extra options
+imei=353220047976425
+[tigo1](defaults)
+`,
+		},
+		{
+			"spaces",
+			FormatOptions{Spaces: true},
+			`; dongles managed by fastc
+[defaults](!)
+context = default ; the default context
+rxgain = 2 ;gain
+exten => s,1,Answer()
+
+; the first modem
+[airtel1](defaults)
+	; where it is plugged
+audio = /dev/ttyUSB1
+#include "airtel.conf" ; extra options
+imei = 353220047976425
+[tigo1](defaults)
+`,
+		},
+		{
+			"align comments",
+			FormatOptions{AlignComments: true},
+			`; dongles managed by fastc
+[defaults](!)
+context=default ; the default context
+rxgain=2        ;gain
+exten=>s,1,Answer()
+
+; the first modem
+[airtel1](defaults)
+	; where it is plugged
+audio=/dev/ttyUSB1
+#include "airtel.conf" ; extra options
+imei=353220047976425
+[tigo1](defaults)
+`,
+		},
+		{
+			"section lines",
+			FormatOptions{SectionLines: true},
+			`; dongles managed by fastc
+[defaults](!)
+context=default ; the default context
+rxgain=2 ;gain
+exten=>s,1,Answer()
+
+; the first modem
+[airtel1](defaults)
+	; where it is plugged
+audio=/dev/ttyUSB1
+#include "airtel.conf" ; extra options
+imei=353220047976425
+
+[tigo1](defaults)
+`,
+		},
+	}
+	for _, v := range sample {
+		a := parseFormatSample(t, src)
+		var buf bytes.Buffer
+		if err := Format(&buf, a, v.opts); err != nil {
+			t.Fatal(err)
+		}
+		if buf.String() != v.expect {
+			t.Errorf("%s: expected\n%s\ngot\n%s", v.name, v.expect, buf.String())
+		}
+	}
+}
+
+// TestFormatStable checks that formatting keeps the definitions, and that a
+// formatted file is left as it is.
+func TestFormatStable(t *testing.T) {
+	b, err := ioutil.ReadFile("testdata/modem.conf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, opts := range []FormatOptions{
+		{},
+		{Spaces: true, AlignComments: true, SectionLines: true},
+	} {
+		a := parseFormatSample(t, string(b))
+		var buf bytes.Buffer
+		if err = Format(&buf, a, opts); err != nil {
+			t.Fatal(err)
+		}
+		formatted := parseFormatSample(t, buf.String())
+		if !reflect.DeepEqual(definitions(a), definitions(formatted)) {
+			t.Errorf("%+v: the definitions changed", opts)
+		}
+		var again bytes.Buffer
+		if err = Format(&again, formatted, opts); err != nil {
+			t.Fatal(err)
+		}
+		if again.String() != buf.String() {
+			t.Errorf("%+v: formatting twice changed the output", opts)
+		}
+	}
+}
+
+func parseFormatSample(t *testing.T, src string) *Ast {
+	p, err := NewParser(strings.NewReader(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, err := p.Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return a
+}
+
+// definitions returns the definitions of a as section.key=value lines.
+func definitions(a *Ast) []string {
+	var o []string
+	for _, s := range a.Sections {
+		for _, v := range s.Values() {
+			o = append(o, s.Name()+"."+v.Key()+v.Operator()+v.Value())
+		}
+	}
+	return o
+}
@@ -0,0 +1,206 @@
+package asteriskconf
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// IncludeMode controls how ParseFile handles the #include, #tryinclude and
+// #exec directives.
+type IncludeMode int
+
+// The supported include modes
+const (
+	// IncludeNone keeps the directives in the Ast without following them.
+	IncludeNone IncludeMode = iota
+
+	// IncludeFiles parses the files named by #include and #tryinclude as if
+	// their content was in place of the directive.
+	IncludeFiles
+
+	// IncludeExec is like IncludeFiles, but also runs the commands of #exec
+	// directives and parses their output.
+	IncludeExec
+)
+
+// NodeDirective is a #include, #tryinclude or #exec directive.
+type NodeDirective struct {
+	name   string
+	arg    string
+	line   int
+	column int
+	file   string
+
+	// at is the number of definitions of the section that come before the
+	// directive.
+	at int
+
+	// lead is the comments and blank lines before the directive, tokens is the
+	// directive line.
+	lead   []*Token
+	tokens []*Token
+}
+
+// Name returns the name of the directive without the #, one of include,
+// tryinclude or exec.
+func (d *NodeDirective) Name() string {
+	return d.name
+}
+
+// Arg returns the file name, glob pattern or command of the directive.
+func (d *NodeDirective) Arg() string {
+	return d.arg
+}
+
+// Line returns the line of the directive.
+func (d *NodeDirective) Line() int {
+	return d.line
+}
+
+// Dir returns the asterisk configuration directory. It is the value of the
+// ASTERISK_CONFIG environment variable, or /etc/asterisk when it is not set.
+func Dir() string {
+	if dir := os.Getenv("ASTERISK_CONFIG"); dir != "" {
+		return dir
+	}
+	return "/etc/asterisk"
+}
+
+// ParseFile parses the configuration file name. Relative file names, including
+// the ones in #include and #tryinclude directives, are looked up in dir, or in
+// the asterisk configuration directory returned by Dir when dir is empty.
+//
+// The included files are followed according to mode. The sections of the
+// returned Ast remember the file they come from, and the Ast can still be
+// printed with PrintCST, which writes only what comes from the file name.
+func ParseFile(dir, name string, mode IncludeMode) (*Ast, error) {
+	if dir == "" {
+		dir = Dir()
+	}
+	if !filepath.IsAbs(name) {
+		name = filepath.Join(dir, name)
+	}
+	b, err := ioutil.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	p, err := NewParser(bytes.NewReader(b))
+	if err != nil {
+		return nil, err
+	}
+	p.file = name
+	p.dir = dir
+	p.mode = mode
+	p.stack = []string{name}
+	return p.Parse()
+}
+
+// parseDirective parses the directive in tok, which is expected to be the last
+// token on its line.
+func (p *Parser) parseDirective(tok *Token) (*NodeDirective, error) {
+	d := &NodeDirective{line: tok.Line, column: tok.Column}
+	txt := strings.TrimPrefix(tok.Text, "#")
+	if i := strings.IndexAny(txt, " \t\"<"); i != -1 {
+		d.name, d.arg = txt[:i], strings.TrimSpace(txt[i:])
+	} else {
+		d.name = txt
+	}
+	switch d.name {
+	case "include", "tryinclude", "exec":
+	default:
+		return nil, d.errorf("unknown directive %s", tok.Text)
+	}
+	if n := len(d.arg); n > 1 &&
+		(d.arg[0] == '"' && d.arg[n-1] == '"' || d.arg[0] == '<' && d.arg[n-1] == '>') {
+		d.arg = d.arg[1 : n-1]
+	}
+	if d.arg == "" {
+		return nil, d.errorf("missing argument in %s", tok.Text)
+	}
+	if next := p.next(); next.Type != NLine && next.Type != EOF {
+		return nil, newParseError(next, NLine)
+	}
+	return d, nil
+}
+
+// include parses the input named by the directive d into sec, and returns the
+// section that is open at the end of the included input.
+func (p *Parser) include(sec *NodeSection, d *NodeDirective) (*NodeSection, error) {
+	if d.name == "exec" {
+		if p.mode != IncludeExec {
+			return sec, nil
+		}
+		out, err := exec.Command("/bin/sh", "-c", d.arg).Output()
+		if err != nil {
+			return nil, d.errorf("#exec %s: %v", d.arg, err)
+		}
+		return p.parseIncluded(sec, "exec "+d.arg, out)
+	}
+	pattern := d.arg
+	if !filepath.IsAbs(pattern) {
+		pattern = filepath.Join(p.dir, pattern)
+	}
+	files, err := filepath.Glob(pattern)
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		if d.name == "tryinclude" {
+			return sec, nil
+		}
+		return nil, d.errorf("included file %s not found", d.arg)
+	}
+	for _, f := range files {
+		for _, v := range p.stack {
+			if v == f {
+				return nil, d.errorf("include cycle %s -> %s",
+					strings.Join(p.stack, " -> "), f)
+			}
+		}
+		b, err := ioutil.ReadFile(f)
+		if err != nil {
+			return nil, d.errorf("%v", err)
+		}
+		sec, err = p.parseIncluded(sec, f, b)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return sec, nil
+}
+
+// parseIncluded parses src, the content of the included file name, into sec.
+func (p *Parser) parseIncluded(sec *NodeSection, name string, src []byte) (*NodeSection, error) {
+	np, err := NewParser(bytes.NewReader(src))
+	if err != nil {
+		return nil, err
+	}
+	np.Ast = p.Ast
+	np.AllErrors = p.AllErrors
+	np.file = name
+	np.dir = p.dir
+	np.mode = p.mode
+	np.stack = append(p.stack[:len(p.stack):len(p.stack)], name)
+	p.Ast.files = append(p.Ast.files, name)
+	sec, err = np.parse(sec)
+	p.errors = append(p.errors, np.errors...)
+	if err != nil {
+		return nil, setFile(err, name)
+	}
+	return sec, nil
+}
+
+// errorf returns a *ParseError at the position of the directive.
+func (d *NodeDirective) errorf(format string, args ...interface{}) *ParseError {
+	return &ParseError{
+		File:   d.file,
+		Line:   d.line,
+		Column: d.column,
+		Msg:    fmt.Sprintf(format, args...),
+	}
+}
@@ -0,0 +1,155 @@
+package asteriskconf
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeFiles(t *testing.T, files map[string]string) string {
+	dir, err := ioutil.TempDir("", "fastc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for k, v := range files {
+		err = ioutil.WriteFile(filepath.Join(dir, k), []byte(v), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func TestParseFile(t *testing.T) {
+	dongle := `[general]
+interval=15
+#include dongle_fessbox.conf ; generated by fastc
+rxgain=3
+#tryinclude "dongle_missing.conf"
+#include <extra_*.conf>
+`
+	dir := writeFiles(t, map[string]string{
+		"dongle.conf":         dongle,
+		"dongle_fessbox.conf": "jbenable=yes\n[airtel1]\nimei=353220047976425\n",
+		"extra_1.conf":        "[tigo1]\nimei=352215045819420\n",
+	})
+	defer os.RemoveAll(dir)
+
+	a, err := ParseFile(dir, "dongle.conf", IncludeNone)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(a.Sections) != 2 {
+		t.Errorf("expected 2 sections got %d", len(a.Sections))
+	}
+	general, err := a.Section("general")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(general.directives) != 3 {
+		t.Fatalf("expected 3 directives got %d", len(general.directives))
+	}
+	d := general.directives[0]
+	if d.name != "include" || d.arg != "dongle_fessbox.conf" || d.at != 1 {
+		t.Errorf("expected include dongle_fessbox.conf at 1 got %s %s at %d", d.name, d.arg, d.at)
+	}
+	if d = general.directives[2]; d.arg != "extra_*.conf" {
+		t.Errorf("expected extra_*.conf got %s", d.arg)
+	}
+
+	a, err = ParseFile(dir, "dongle.conf", IncludeFiles)
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := a.Files()
+	if len(files) != 3 || files[1] != filepath.Join(dir, "dongle_fessbox.conf") {
+		t.Errorf("expected 3 files got %v", files)
+	}
+	general, err = a.Section("general")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := general.Get("jbenable"); v != "yes" {
+		t.Errorf("expected jbenable=yes in general got %q", v)
+	}
+	airtel, err := a.Section("airtel1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if airtel.File() != filepath.Join(dir, "dongle_fessbox.conf") {
+		t.Errorf("expected airtel1 from dongle_fessbox.conf got %s", airtel.File())
+	}
+
+	// asterisk keeps adding to the last section of the included file.
+	if v, _ := airtel.Get("rxgain"); v != "3" {
+		t.Errorf("expected rxgain=3 in airtel1 got %q", v)
+	}
+	if _, err = a.Section("tigo1"); err != nil {
+		t.Error(err)
+	}
+
+	buf := &bytes.Buffer{}
+	err = PrintCST(buf, a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != dongle {
+		t.Errorf("expected %q got %q", dongle, buf.String())
+	}
+}
+
+func TestParseFileErrors(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"a.conf":       "[a]\n#include b.conf\n",
+		"b.conf":       "[b]\n#include a.conf\n",
+		"missing.conf": "#include nothing.conf\n",
+		"unknown.conf": "#define x\n",
+	})
+	defer os.RemoveAll(dir)
+
+	_, err := ParseFile(dir, "a.conf", IncludeFiles)
+	if err == nil || !strings.Contains(err.Error(), "include cycle") {
+		t.Errorf("expected an include cycle error got %v", err)
+	}
+	_, err = ParseFile(dir, "a.conf", IncludeNone)
+	if err != nil {
+		t.Error(err)
+	}
+	_, err = ParseFile(dir, "missing.conf", IncludeFiles)
+	if err == nil {
+		t.Error("expected an error")
+	}
+	_, err = ParseFile(dir, "unknown.conf", IncludeNone)
+	if err == nil {
+		t.Error("expected an error")
+	}
+}
+
+func TestParseFileExec(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"exec.conf": "[general]\n#exec printf '[generated]\\nfoo=bar\\n'\n",
+	})
+	defer os.RemoveAll(dir)
+
+	a, err := ParseFile(dir, "exec.conf", IncludeFiles)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = a.Section("generated"); err == nil {
+		t.Error("expected #exec not to run")
+	}
+	a, err = ParseFile(dir, "exec.conf", IncludeExec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sec, err := a.Section("generated")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := sec.Get("foo"); v != "bar" {
+		t.Errorf("expected foo=bar got %q", v)
+	}
+}
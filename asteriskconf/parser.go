@@ -0,0 +1,795 @@
+package asteriskconf
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Ast is an abstract syntax tree for a scanneruration object. The scanneruration
+// format should be section based( or you can say namespacing).
+type Ast struct {
+	Sections []*NodeSection
+
+	// trail is the comments and blank lines after the last definition.
+	trail []*Token
+
+	// file is the name of the parsed file, files are all the files that were
+	// parsed including the ones that were included.
+	file  string
+	files []string
+}
+
+// Files returns the names of the files the Ast was parsed from. The first one
+// is the parsed file, it is followed by the included files in the order they
+// were included.
+func (a *Ast) Files() []string {
+	return a.files
+}
+
+//Section returns the section named name or an error if the section is not found
+//in the Ast
+func (a *Ast) Section(name string) (*NodeSection, error) {
+	for _, v := range a.Sections {
+		if v.name == name {
+			return v, nil
+		}
+	}
+	return nil, errors.New("section not found")
+}
+
+// Resolve returns the section named name with all the definitions inherited from
+// its templates merged in.
+//
+// Templates are applied in the order they are listed in the section header, a
+// template's own templates are applied before it. The definitions of the section
+// come last, and any key defined again overrides the inherited value, just like
+// asterisk does. The sections in the Ast are not modified.
+func (a *Ast) Resolve(name string) (*NodeSection, error) {
+	return a.resolve(name, make(map[string]bool))
+}
+
+func (a *Ast) resolve(name string, seen map[string]bool) (*NodeSection, error) {
+	sec, err := a.Section(name)
+	if err != nil {
+		return nil, err
+	}
+	if seen[name] {
+		return nil, errors.New("template loop at section " + name)
+	}
+	seen[name] = true
+	defer delete(seen, name)
+
+	o := &NodeSection{
+		name:     sec.name,
+		line:     sec.line,
+		template: sec.template,
+		inherits: sec.inherits,
+	}
+	for _, t := range sec.inherits {
+		tpl, err := a.resolve(t, seen)
+		if err != nil {
+			return nil, err
+		}
+		if !tpl.template {
+			return nil, errors.New("section " + t + " is not a template")
+		}
+		o.merge(tpl.Values())
+	}
+	o.merge(sec.Values())
+	return o, nil
+}
+
+// merge appends values to the section, dropping the existing definitions whose
+// keys are defined again in values. When the first definition of a key in
+// values uses +=, the existing definitions are kept and the value is appended to
+// them instead.
+func (n *NodeSection) merge(values []*NodeIdent) {
+	keys := make(map[string]bool)
+	seen := make(map[string]bool)
+	for _, v := range values {
+		if !seen[v.key] {
+			seen[v.key] = true
+			keys[v.key] = v.assign != Append
+		}
+	}
+	var kept []*NodeIdent
+	for _, v := range n.values {
+		if !keys[v.key] {
+			kept = append(kept, v)
+		}
+	}
+	n.values = append(kept, values...)
+}
+
+//ToJSON marhalls *Ast to a json string and writes the result to dst
+//
+// Keys that are defined more than once in a section are written as an array of
+// their values.
+func (a *Ast) ToJSON(dst io.Writer) error {
+	o := make(map[string]interface{})
+	for _, v := range a.Sections {
+		if v.appends {
+			continue
+		}
+		sec := make(map[string]interface{})
+		for _, key := range v.keys() {
+			all := v.GetAll(key)
+			if len(all) == 1 {
+				sec[key] = all[0]
+				continue
+			}
+			sec[key] = all
+		}
+		o[v.name] = sec
+	}
+	return json.NewEncoder(dst).Encode(o)
+}
+
+//LoadJSON loads AST from json src
+func (a *Ast) LoadJSON(src []byte) error {
+	var obj map[string]interface{}
+	err := json.Unmarshal(src, &obj)
+	if err != nil {
+		return err
+	}
+	for key, value := range obj {
+		ns := &NodeSection{name: key}
+		switch value.(type) {
+		case map[string]interface{}:
+			sec := value.(map[string]interface{})
+			for k, v := range sec {
+				values, ok := v.([]interface{})
+				if !ok {
+					values = []interface{}{v}
+				}
+				for _, value := range values {
+					ident := &NodeIdent{}
+					ident.key = k
+					ident.value = fmt.Sprint(value)
+					ns.values = append(ns.values, ident)
+				}
+			}
+		}
+		a.Sections = append(a.Sections, ns)
+	}
+	return nil
+}
+
+// PrintAst writes the sections and definitions of src to dst, one definition per
+// line. Comments and the original formatting are not kept, use PrintCST for
+// that, or Format to write them in a canonical format.
+func PrintAst(dst io.Writer, src *Ast) {
+	for _, v := range src.Sections {
+		if v.name == "main" {
+			fmt.Fprintf(dst, "\n\n")
+			for _, sub := range v.values {
+				fmt.Fprintf(dst, "%s%s%s \n", sub.key, sub.Operator(), escapeValue(sub.value))
+			}
+			fmt.Fprint(dst, "\n\n")
+			continue
+		}
+		fmt.Fprintf(dst, "\n[%s]%s\n", v.name, v.options())
+		for _, sub := range v.values {
+			fmt.Fprintf(dst, "%s%s%s \n", sub.key, sub.Operator(), escapeValue(sub.value))
+		}
+		fmt.Fprint(dst, "\n\n")
+		continue
+	}
+}
+
+//NodeSection represent a section in the scanneruration object. Sections are name
+//spaces that contains scannerurations definitions under them.
+//
+// A section can be a template, in which case it is not used directly but its
+// definitions are copied into the sections that inherit from it.
+//
+// A section declared with the (+) option adds its definitions to the section of
+// the same name before it. It is kept in the Ast so that it is printed where it
+// was parsed, and its definitions are returned by the section it appends to.
+type NodeSection struct {
+	name     string
+	line     int
+	template bool
+	inherits []string
+	values   []*NodeIdent
+	file     string
+
+	// appends is true for a section declared with (+), and appended are the
+	// sections appending to this one.
+	appends  bool
+	appended []*NodeSection
+
+	// directives are the #include, #tryinclude and #exec directives found in the
+	// section.
+	directives []*NodeDirective
+
+	// lead is the comments and blank lines before the section header, tokens is
+	// the header line.
+	lead   []*Token
+	tokens []*Token
+}
+
+// NewSection returns a new section named name, inheriting from the templates
+// listed in inherits.
+func NewSection(name string, inherits ...string) *NodeSection {
+	return &NodeSection{name: name, inherits: inherits}
+}
+
+// NewTemplate returns a new template named name, inheriting from the templates
+// listed in inherits.
+func NewTemplate(name string, inherits ...string) *NodeSection {
+	return &NodeSection{name: name, template: true, inherits: inherits}
+}
+
+// Name returns the name of the section.
+func (n *NodeSection) Name() string {
+	return n.name
+}
+
+// Line returns the line of the section header, it is 0 for sections that are
+// not parsed.
+func (n *NodeSection) Line() int {
+	return n.line
+}
+
+// Values returns the definitions of the section in the order they appear,
+// followed by the definitions of the sections appending to it.
+func (n *NodeSection) Values() []*NodeIdent {
+	if len(n.appended) == 0 {
+		return n.values
+	}
+	o := append([]*NodeIdent(nil), n.values...)
+	for _, v := range n.appended {
+		o = append(o, v.values...)
+	}
+	return o
+}
+
+// Appends returns true if the section was declared with the (+) option, its
+// definitions are part of the section of the same name before it.
+func (n *NodeSection) Appends() bool {
+	return n.appends
+}
+
+// Directives returns the #include, #tryinclude and #exec directives of the
+// section.
+func (n *NodeSection) Directives() []*NodeDirective {
+	return n.directives
+}
+
+// Add appends the definitions in values to the end of the section.
+func (n *NodeSection) Add(values ...*NodeIdent) {
+	n.values = append(n.values, values...)
+}
+
+// IsTemplate returns true if the section is declared as a template with the (!)
+// option.
+func (n *NodeSection) IsTemplate() bool {
+	return n.template
+}
+
+// File returns the name of the file the section was parsed from. It is empty
+// for sections that are not parsed from a file.
+func (n *NodeSection) File() string {
+	return n.file
+}
+
+// Inherits returns the names of the templates the section inherits from, in the
+// order they are listed in the section header.
+func (n *NodeSection) Inherits() []string {
+	return n.inherits
+}
+
+// options returns the bracketed options that follow the section name in the
+// section header, or an empty string if there are none.
+func (n *NodeSection) options() string {
+	var opts []string
+	if n.appends {
+		opts = append(opts, "+")
+	}
+	if n.template {
+		opts = append(opts, "!")
+	}
+	opts = append(opts, n.inherits...)
+	if len(opts) == 0 {
+		return ""
+	}
+	return "(" + strings.Join(opts, ",") + ")"
+}
+
+//Get access the key definition and returns its value or an error if the key is
+//not part of the section.
+func (n *NodeSection) Get(key string) (string, error) {
+	all := n.GetAll(key)
+	if len(all) == 0 {
+		return "", errors.New("key not found")
+	}
+	return all[0], nil
+}
+
+// GetAll returns the values of all the definitions of key in the order they
+// appear in the section. A definition using += is appended to the value before
+// it, so it does not add a value of its own unless it is the first definition.
+func (n *NodeSection) GetAll(key string) []string {
+	var o []string
+	for _, v := range n.Values() {
+		if v.key != key {
+			continue
+		}
+		if v.assign == Append && len(o) > 0 {
+			o[len(o)-1] += v.value
+			continue
+		}
+		o = append(o, v.value)
+	}
+	return o
+}
+
+// keys returns the keys defined in the section in the order of their first
+// definition.
+func (n *NodeSection) keys() []string {
+	var o []string
+	seen := make(map[string]bool)
+	for _, v := range n.Values() {
+		if !seen[v.key] {
+			seen[v.key] = true
+			o = append(o, v.key)
+		}
+	}
+	return o
+}
+
+// Objects returns the values of all the object definitions (those using =>)
+// whose key is key, in the order they appear in the section.
+func (n *NodeSection) Objects(key string) []string {
+	var o []string
+	for _, v := range n.values {
+		if v.assign == Arrow && v.key == key {
+			o = append(o, v.value)
+		}
+	}
+	return o
+}
+
+//NodeIdent represents a scanneruration definition, which can be the key value
+//definition.
+//
+// The assign field records the operator used in the definition. Definitions
+// using => are objects, like the extensions in a dialplan or the members of a
+// queue. Definitions using += append their value to the previous definition of
+// the same key.
+type NodeIdent struct {
+	key    string
+	value  string
+	assign TokenType
+	line   int
+	file   string
+
+	// lead is the comments and blank lines before the definition, tokens is the
+	// definition line.
+	lead   []*Token
+	tokens []*Token
+}
+
+// NewIdent returns a new definition of key with value, using the = operator.
+func NewIdent(key, value string) *NodeIdent {
+	return &NodeIdent{key: key, value: value, assign: Assign}
+}
+
+// NewObject returns a new object definition of key with value, using the =>
+// operator.
+func NewObject(key, value string) *NodeIdent {
+	return &NodeIdent{key: key, value: value, assign: Arrow}
+}
+
+// Key returns the key of the definition.
+func (n *NodeIdent) Key() string {
+	return n.key
+}
+
+// Value returns the value of the definition, with escaped semicolons replaced
+// by semicolons.
+func (n *NodeIdent) Value() string {
+	return n.value
+}
+
+// Line returns the line of the definition, it is 0 for definitions that are not
+// parsed.
+func (n *NodeIdent) Line() int {
+	return n.line
+}
+
+// File returns the name of the file the definition was parsed from.
+func (n *NodeIdent) File() string {
+	return n.file
+}
+
+// Operator returns the text of the assignment operator used by n, one of =, =>
+// or +=.
+func (n *NodeIdent) Operator() string {
+	switch n.assign {
+	case Arrow:
+		return "=>"
+	case Append:
+		return "+="
+	}
+	return "="
+}
+
+// Parser is a Parser for scanneruration files. It supports utf-8 encoded
+// scanneruration files.
+//
+// Only modem scanneruration files are supported for the momment.
+type Parser struct {
+	tokens  []*Token
+	Ast     *Ast
+	currPos int
+	trail   []*Token
+
+	// AllErrors makes Parse report all the errors in the input instead of
+	// stopping at the first one.
+	AllErrors bool
+	errors    ErrorList
+
+	// file is the name of the parsed file, dir is where the included files are
+	// looked up and stack holds the files being parsed when following includes.
+	file  string
+	dir   string
+	mode  IncludeMode
+	stack []string
+}
+
+//NewParser returns a new Parser that parses input from src. The returned Parser
+//supports gsm modem scanneruration format only.
+func NewParser(src io.Reader) (*Parser, error) {
+	s := NewScanner(src)
+	var toks []*Token
+	var err error
+	var tok *Token
+	for err == nil {
+		tok, err = s.Scan()
+		if err != nil {
+			if err.Error() != io.EOF.Error() {
+				return nil, err
+			}
+
+			// we are at the end of the input
+			break
+		}
+		if tok != nil {
+
+			// Comments and whitespaces are kept so that the input can be
+			// reproduced, the parser skips over them.
+			toks = append(toks, tok)
+		}
+	}
+	return &Parser{tokens: toks, Ast: &Ast{}}, nil
+}
+
+// Parse parses the scanned input and return its *Ast or arror if any.
+//
+// Definitions that appear before the first section header are collected in a
+// section named main.
+//
+// Every section header and definition keeps the tokens of its line, together
+// with the comments and blank lines that come before it, so the returned *Ast
+// can be printed back exactly as it was read with PrintCST.
+//
+// The parsing stops at the first error, unless AllErrors is set. In that case
+// the parsing resumes on the next line, and all the errors are returned as an
+// ErrorList together with the *Ast of what could be parsed.
+func (p *Parser) Parse() (*Ast, error) {
+	mainSec := &NodeSection{name: "main", file: p.file}
+	_, err := p.parse(mainSec)
+	if err != nil {
+		return nil, setFile(err, p.file)
+	}
+	if p.file != "" {
+		p.Ast.file = p.file
+		p.Ast.files = append([]string{p.file}, p.Ast.files...)
+	}
+	p.Ast.trail = p.trail
+	p.Ast.Sections = append([]*NodeSection{mainSec}, p.Ast.Sections...)
+	if len(p.errors) > 0 {
+		return p.Ast, p.errors
+	}
+	return p.Ast, nil
+}
+
+// parse parses the tokens adding the definitions to sec until a section header
+// is found. It returns the section that is open at the end of the input.
+func (p *Parser) parse(sec *NodeSection) (*NodeSection, error) {
+	var err error
+	lead := 0
+END:
+	for {
+		start := p.currPos
+		tok := p.next()
+		switch tok.Type {
+		case EOF:
+			break END
+		case NLine:
+			continue
+		case LBrace:
+			p.seek(start)
+			var ns *NodeSection
+			ns, err = p.parseSection()
+			if err != nil {
+				break
+			}
+			if ns.appends {
+				base, serr := p.Ast.Section(ns.name)
+				if serr != nil || base.appends {
+					err = &ParseError{Line: ns.line, Column: 1,
+						Msg: "no section " + ns.name + " to append to"}
+					break
+				}
+				base.appended = append(base.appended, ns)
+			}
+			sec = ns
+			sec.file = p.file
+			sec.lead = p.span(lead, start)
+			sec.tokens = p.span(start, p.currPos)
+			lead = p.currPos
+			p.Ast.Sections = append(p.Ast.Sections, sec)
+		case Ident:
+			p.seek(start)
+			var n *NodeIdent
+			n, err = p.parseIdent()
+			if err != nil || n == nil {
+				break
+			}
+			n.file = p.file
+			n.lead = p.span(lead, start)
+			n.tokens = p.span(start, p.currPos)
+			lead = p.currPos
+			sec.values = append(sec.values, n)
+		case Directive:
+			var d *NodeDirective
+			d, err = p.parseDirective(tok)
+			if err != nil {
+				break
+			}
+			d.at = len(sec.values)
+			d.file = p.file
+			d.lead = p.span(lead, start)
+			d.tokens = p.span(start, p.currPos)
+			lead = p.currPos
+			sec.directives = append(sec.directives, d)
+			if p.mode != IncludeNone {
+				var included *NodeSection
+				included, err = p.include(sec, d)
+				if err == nil {
+					sec = included
+				}
+			}
+		default:
+			err = newParseError(tok, Ident, LBrace, Directive)
+		}
+		if err != nil {
+			if !p.recover(err) {
+				return nil, err
+			}
+			err = nil
+		}
+	}
+	p.trail = p.span(lead, len(p.tokens))
+	return sec, nil
+}
+
+// recover records err and skips the rest of the line when the parser reports
+// all errors. It returns false if the parsing should stop with err instead.
+func (p *Parser) recover(err error) bool {
+	if !p.AllErrors {
+		return false
+	}
+	switch e := setFile(err, p.file).(type) {
+	case *ParseError:
+		p.errors = append(p.errors, e)
+	case ErrorList:
+		p.errors = append(p.errors, e...)
+	default:
+		return false
+	}
+	if p.currPos > 0 && p.currPos <= len(p.tokens) && p.tokens[p.currPos-1].Type == NLine {
+		return true
+	}
+	for {
+		switch p.next().Type {
+		case NLine, EOF:
+			return true
+		}
+	}
+}
+
+// next returns the next token that is not a comment or white space. The EOF
+// token is returned when there are no more tokens.
+func (p *Parser) next() *Token {
+	for p.currPos < len(p.tokens) {
+		t := p.tokens[p.currPos]
+		p.currPos++
+		switch t.Type {
+		case WhiteSpace, Comment:
+			continue
+		}
+		return t
+	}
+	return &Token{Type: EOF}
+}
+
+// span returns the scanned tokens from begin up to end. The returned slice can
+// be appended to without affecting the tokens that come after it.
+func (p *Parser) span(begin, end int) []*Token {
+	if end > len(p.tokens) {
+		end = len(p.tokens)
+	}
+	if begin >= end {
+		return nil
+	}
+	return p.tokens[begin:end:end]
+}
+
+func (p *Parser) seek(at int) {
+	p.currPos = at
+}
+
+// parseSection parses a section header. The header is the section name
+// enclosed in square brackets, optionally followed by a list of options in
+// brackets.
+//
+//	[name]          a normal section
+//	[name](!)       a template
+//	[name](a,b)     a section inheriting from templates a and b
+//	[name](!,a)     a template inheriting from template a
+//
+// The definitions that follow the header are not part of the header, they are
+// added to the section by the caller.
+func (p *Parser) parseSection() (*NodeSection, error) {
+	left := p.next()
+	if left.Type != LBrace {
+		return nil, newParseError(left, LBrace)
+	}
+	ns := &NodeSection{line: left.Line}
+	nameStart := p.currPos
+	completeName := false
+END:
+	for {
+		tok := p.next()
+		switch tok.Type {
+		case EOF, NLine:
+			break END
+		case Ident:
+			if completeName {
+				return nil, newParseError(tok, LBracket, NLine)
+			}
+		case RBrace:
+			if completeName {
+				return nil, newParseError(tok, LBracket, NLine)
+			}
+			ns.name = strings.TrimSpace(tokensText(p.tokens[nameStart : p.currPos-1]))
+			completeName = true
+		case LBracket:
+			if !completeName {
+				return nil, newParseError(tok, Ident, RBrace)
+			}
+			err := p.parseTemplateOptions(ns)
+			if err != nil {
+				return nil, err
+			}
+		default:
+			if completeName {
+				return nil, newParseError(tok, LBracket, NLine)
+			}
+			return nil, newParseError(tok, Ident, RBrace)
+		}
+	}
+	if !completeName {
+		return nil, newParseError(p.tokens[p.currPos-1], Ident, RBrace)
+	}
+	return ns, nil
+}
+
+// parseTemplateOptions parses the comma separated options that follow the
+// section name, the opening bracket is expected to be already consumed.
+func (p *Parser) parseTemplateOptions(ns *NodeSection) error {
+	var name string
+	for {
+		tok := p.next()
+		switch tok.Type {
+		case Exclam:
+			if name != "" {
+				return newParseError(tok, Comma, RBracket)
+			}
+			ns.template = true
+		case Ident:
+			name = name + tok.Text
+		case Comma, RBracket:
+			switch name {
+			case "":
+			case "+":
+				ns.appends = true
+			default:
+				ns.inherits = append(ns.inherits, name)
+			}
+			name = ""
+			if tok.Type == RBracket {
+				return nil
+			}
+		default:
+			return newParseError(tok, Ident, Comma, RBracket)
+		}
+	}
+}
+
+// parseIdent parses a definition. It returns a nil *NodeIdent if the line has
+// no assignment operator, asterisk ignores such lines.
+func (p *Parser) parseIdent() (n *NodeIdent, err error) {
+	n = &NodeIdent{}
+	doneKey := false
+	keyStart := -1
+END:
+	for {
+	BEGIN:
+		tok := p.next()
+		if !doneKey {
+			switch tok.Type {
+			case Ident:
+				if keyStart == -1 {
+					n.line = tok.Line
+					keyStart = p.currPos - 1
+				}
+				goto BEGIN
+			case Assign, Arrow, Append:
+				n.assign = tok.Type
+				n.key = strings.TrimSpace(tokensText(p.tokens[keyStart : p.currPos-1]))
+				doneKey = true
+				goto BEGIN
+			case EOF, NLine:
+				return nil, nil
+			default:
+				err = newParseError(tok, Assign, Arrow, Append)
+				break END
+			}
+
+		}
+		switch tok.Type {
+		case EOF, NLine:
+			break END
+		case Value:
+			n.value = n.value + unescapeValue(tok.Text)
+			goto BEGIN
+		default:
+			err = newParseError(tok, NLine)
+			break END
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return n, nil
+}
+
+// tokensText returns the text of toks joined together.
+func tokensText(toks []*Token) string {
+	var buf bytes.Buffer
+	for _, v := range toks {
+		buf.WriteString(v.Text)
+	}
+	return buf.String()
+}
+
+// unescapeValue returns the value of the scanned text s, where an escaped
+// semicolon \; stands for a semicolon.
+func unescapeValue(s string) string {
+	return strings.Replace(s, `\;`, ";", -1)
+}
+
+// escapeValue returns s with the semicolons escaped, so that it can be written
+// as a value without being taken as a comment.
+func escapeValue(s string) string {
+	return strings.Replace(s, ";", `\;`, -1)
+}
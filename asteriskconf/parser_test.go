@@ -0,0 +1,586 @@
+package asteriskconf
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParser(t *testing.T) {
+	src, err := ioutil.ReadFile("testdata/modem.conf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := NewParser(bytes.NewReader(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ass, err := p.Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	mainSample := []struct {
+		section, key, value string
+	}{
+		{"main", "interval", "15"},
+		{"defaults", "group", "0"},
+		{"defaults", "language", "en"},
+		{"vodacom1", "imei", "354369047238580"},
+	}
+	for _, v := range mainSample {
+		sec, err := ass.Section(v.section)
+		if err != nil {
+			t.Fatal(err)
+		}
+		value, err := sec.Get(v.key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if value != v.value {
+			t.Errorf("expected %s got %s", v.value, value)
+		}
+	}
+
+	// test the encoding to json
+	dst := &bytes.Buffer{}
+	err = ass.ToJSON(dst)
+	if err != nil {
+		t.Error(err)
+	}
+	nAst := &Ast{}
+	err = nAst.LoadJSON(dst.Bytes())
+	if err != nil {
+		t.Error(err)
+	}
+
+	for _, v := range mainSample {
+		sec, err := nAst.Section(v.section)
+		if err != nil {
+			t.Fatal(err)
+		}
+		value, err := sec.Get(v.key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if value != v.value {
+			t.Errorf("expected %s got %s", v.value, value)
+		}
+	}
+	nBuf := &bytes.Buffer{}
+	PrintAst(nBuf, nAst)
+
+	np, err := NewParser(nBuf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = np.Parse()
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func TestParseTemplates(t *testing.T) {
+	src := `[defaults](!)
+context=from-trunk
+group=0
+
+rxgain=2
+
+[gsm](!,defaults)
+group=1
+
+[airtel1](gsm)
+imei=353220047976425
+rxgain=4
+`
+	p, err := NewParser(bytes.NewBufferString(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, err := p.Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tpl, err := a.Section("defaults")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !tpl.IsTemplate() {
+		t.Error("expected defaults to be a template")
+	}
+	if len(tpl.values) != 3 {
+		t.Errorf("expected 3 values got %d", len(tpl.values))
+	}
+	gsm, err := a.Section("gsm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !gsm.IsTemplate() || len(gsm.Inherits()) != 1 || gsm.Inherits()[0] != "defaults" {
+		t.Errorf("expected template inheriting from defaults got %v", gsm.Inherits())
+	}
+	sec, err := a.Resolve("airtel1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sec.IsTemplate() {
+		t.Error("expected airtel1 not to be a template")
+	}
+	expect := []struct {
+		key, value string
+	}{
+		{"context", "from-trunk"},
+		{"group", "1"},
+		{"imei", "353220047976425"},
+		{"rxgain", "4"},
+	}
+	if len(sec.values) != len(expect) {
+		t.Fatalf("expected %d values got %d", len(expect), len(sec.values))
+	}
+	for i, v := range expect {
+		if sec.values[i].key != v.key || sec.values[i].value != v.value {
+			t.Errorf("expected %s=%s got %s=%s", v.key, v.value,
+				sec.values[i].key, sec.values[i].value)
+		}
+	}
+
+	buf := &bytes.Buffer{}
+	PrintAst(buf, a)
+	if !bytes.Contains(buf.Bytes(), []byte("[gsm](!,defaults)")) {
+		t.Errorf("expected template header to be printed got %s", buf)
+	}
+
+	_, err = a.Resolve("missing")
+	if err == nil {
+		t.Error("expected an error")
+	}
+}
+
+func TestParseObjects(t *testing.T) {
+	src := `[app-blacklist]
+include => app-blacklist-custom
+exten => s,1,Macro(user-callerid,)
+exten => 32,1,Goto(app-blacklist-last,s,1)
+
+[support]
+strategy=ringall
+member => agent1
+member=>agent2
+`
+	p, err := NewParser(bytes.NewBufferString(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, err := p.Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sec, err := a.Section("app-blacklist")
+	if err != nil {
+		t.Fatal(err)
+	}
+	inc := sec.Objects("include")
+	if len(inc) != 1 || inc[0] != "app-blacklist-custom" {
+		t.Errorf("expected include app-blacklist-custom got %v", inc)
+	}
+	exten := sec.Objects("exten")
+	if len(exten) != 2 {
+		t.Fatalf("expected 2 extensions got %d", len(exten))
+	}
+	if exten[0] != "s,1,Macro(user-callerid,)" {
+		t.Errorf("expected s,1,Macro(user-callerid,) got %s", exten[0])
+	}
+	if exten[1] != "32,1,Goto(app-blacklist-last,s,1)" {
+		t.Errorf("expected 32,1,Goto(app-blacklist-last,s,1) got %s", exten[1])
+	}
+
+	sec, err = a.Section("support")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sec.Objects("strategy")) != 0 {
+		t.Error("expected strategy not to be an object")
+	}
+	member := sec.Objects("member")
+	if len(member) != 2 || member[0] != "agent1" || member[1] != "agent2" {
+		t.Errorf("expected two members got %v", member)
+	}
+
+	buf := &bytes.Buffer{}
+	PrintAst(buf, a)
+	if !bytes.Contains(buf.Bytes(), []byte("member=>agent1")) {
+		t.Errorf("expected object to be printed with => got %s", buf)
+	}
+}
+
+func TestParseMultiValues(t *testing.T) {
+	src := `[codecs](!)
+disallow=all
+allow=ulaw
+
+[trunk](codecs)
+allow+=,alaw
+allow=gsm
+context=from-trunk
+context+=-dongle
+`
+	p, err := NewParser(bytes.NewBufferString(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, err := p.Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sec, err := a.Section("trunk")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sec.values[0].assign != Append || sec.values[0].Operator() != "+=" {
+		t.Errorf("expected += to be kept got %s", sec.values[0].Operator())
+	}
+	v, err := sec.Get("context")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v != "from-trunk-dongle" {
+		t.Errorf("expected from-trunk-dongle got %s", v)
+	}
+	all := sec.GetAll("allow")
+	if len(all) != 2 || all[0] != ",alaw" || all[1] != "gsm" {
+		t.Errorf("expected [,alaw gsm] got %v", all)
+	}
+
+	sec, err = a.Resolve("trunk")
+	if err != nil {
+		t.Fatal(err)
+	}
+	all = sec.GetAll("allow")
+	if len(all) != 2 || all[0] != "ulaw,alaw" || all[1] != "gsm" {
+		t.Errorf("expected [ulaw,alaw gsm] got %v", all)
+	}
+
+	buf := &bytes.Buffer{}
+	err = a.ToJSON(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var o map[string]map[string]interface{}
+	err = json.Unmarshal(buf.Bytes(), &o)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if allow, ok := o["trunk"]["allow"].([]interface{}); !ok || len(allow) != 2 {
+		t.Errorf("expected allow to be an array got %v", o["trunk"]["allow"])
+	}
+	if o["trunk"]["context"] != "from-trunk-dongle" {
+		t.Errorf("expected from-trunk-dongle got %v", o["trunk"]["context"])
+	}
+
+	nAst := &Ast{}
+	err = nAst.LoadJSON(buf.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	sec, err = nAst.Section("trunk")
+	if err != nil {
+		t.Fatal(err)
+	}
+	all = sec.GetAll("allow")
+	if len(all) != 2 || all[0] != ",alaw" || all[1] != "gsm" {
+		t.Errorf("expected [,alaw gsm] got %v", all)
+	}
+
+	buf.Reset()
+	PrintAst(buf, a)
+	if !bytes.Contains(buf.Bytes(), []byte("context+=-dongle")) {
+		t.Errorf("expected += to be printed got %s", buf)
+	}
+}
+
+func TestParseTemplateFile(t *testing.T) {
+	src, err := ioutil.ReadFile("../extensions_additional.conf.fastc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := NewParser(bytes.NewReader(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, err := p.Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	globals, err := a.Section("globals")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sample := []struct {
+		key, value string
+	}{
+		{"OUT_1", "IAX2/ipkall"},
+		{"ASTETCDIR", "/etc/asterisk"},
+		{"NULL", `""`},
+		{"VM_OPTS", ""},
+		{"OUT_{{$v.trunkID}}", "AMP:Dongle/{{$v.name}}/$OUTNUM$"},
+	}
+	for _, v := range sample {
+		value, err := globals.Get(v.key)
+		if err != nil {
+			t.Fatalf("%s: %v", v.key, err)
+		}
+		if value != v.value {
+			t.Errorf("expected %s got %s", v.value, value)
+		}
+	}
+	buf := &bytes.Buffer{}
+	err = PrintCST(buf, a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf.Bytes(), src) {
+		t.Error("expected the printed file to be the same as the source")
+	}
+	src = []byte("[escaped]\nkey=a\\;b ; comment\n")
+	p, err = NewParser(bytes.NewReader(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, err = p.Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sec, err := a.Section("escaped")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := sec.Get("key"); v != "a;b" {
+		t.Errorf("expected a;b got %s", v)
+	}
+	sec.Set("key", "c;d")
+	buf.Reset()
+	err = PrintCST(buf, a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != "[escaped]\nkey=c\\;d ; comment\n" {
+		t.Errorf("expected the semicolon to be escaped got %q", buf.String())
+	}
+}
+
+func TestParseAppend(t *testing.T) {
+	src := `[defaults](!)
+context=from-trunk
+
+[airtel1](defaults)
+imei=353220047976425
+
+[tigo1]
+imei=352215045819420
+
+; more options for airtel1
+[airtel1](+)
+context=from-airtel
+audio=/dev/ttyUSB1
+`
+	p, err := NewParser(bytes.NewBufferString(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, err := p.Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sec, err := a.Section("airtel1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sec.Appends() || len(sec.Inherits()) != 1 {
+		t.Errorf("expected the first airtel1 section got %v", sec.Inherits())
+	}
+	if last := a.Sections[len(a.Sections)-1]; !last.Appends() || len(last.Inherits()) != 0 {
+		t.Errorf("expected the last section to append got %v", last.Inherits())
+	}
+	if v, err := sec.Get("audio"); err != nil || v != "/dev/ttyUSB1" {
+		t.Errorf("expected the appended audio got %q %v", v, err)
+	}
+	r, err := a.Resolve("airtel1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := []string{"imei=353220047976425", "context=from-airtel", "audio=/dev/ttyUSB1"}
+	var got []string
+	for _, v := range r.Values() {
+		got = append(got, v.Key()+"="+v.Value())
+	}
+	if strings.Join(got, " ") != strings.Join(expect, " ") {
+		t.Errorf("expected %v got %v", expect, got)
+	}
+	var buf bytes.Buffer
+	if err = PrintCST(&buf, a); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != src {
+		t.Errorf("expected the input to be printed back got\n%s", buf.String())
+	}
+
+	p, err = NewParser(bytes.NewBufferString("[a]\nx=1\n[b](+)\ny=2\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = p.Parse(); err == nil || err.Error() != "3:1: no section b to append to" {
+		t.Errorf("expected an error for appending to a missing section got %v", err)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	src := "[general]\n" +
+		"interval=15\n" +
+		"[broken\n" +
+		"context=from-trunk\n" +
+		"  foo(bar)=1\n" +
+		"[airtel1](!\n" +
+		"imei=353220047976425\n" +
+		"\x01\n" +
+		"[tigo1]\n" +
+		"imei=352215045819420\n"
+	expect := []struct {
+		line, column int
+		text         string
+		expected     []TokenType
+		msg          string
+	}{
+		{3, 8, "\n", []TokenType{Ident, RBrace}, "3:8: unexpected new line, expected identifier or ]"},
+		{5, 6, "(", []TokenType{Assign, Arrow, Append}, "5:6: unexpected (, expected = or => or +="},
+		{6, 12, "\n", []TokenType{Ident, Comma, RBracket}, "6:12: unexpected new line, expected identifier or , or )"},
+		{8, 1, "\x01", []TokenType{Ident, LBrace, Directive}, `8:1: unexpected illegal character "\x01", expected identifier or [ or directive`},
+	}
+
+	p, err := NewParser(bytes.NewBufferString(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = p.Parse()
+	e, ok := err.(*ParseError)
+	if !ok {
+		t.Fatalf("expected *ParseError got %v", err)
+	}
+	if e.Line != expect[0].line || e.Column != expect[0].column || e.Token.Text != expect[0].text {
+		t.Errorf("expected error at %d:%d got %d:%d", expect[0].line, expect[0].column, e.Line, e.Column)
+	}
+
+	p, err = NewParser(bytes.NewBufferString(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.AllErrors = true
+	a, err := p.Parse()
+	list, ok := err.(ErrorList)
+	if !ok {
+		t.Fatalf("expected ErrorList got %v", err)
+	}
+	if len(list) != len(expect) {
+		t.Fatalf("expected %d errors got %d: %v", len(expect), len(list), list)
+	}
+	for i, v := range expect {
+		e := list[i]
+		if e.Line != v.line || e.Column != v.column || e.Token.Text != v.text {
+			t.Errorf("expected error at %d:%d got %d:%d", v.line, v.column, e.Line, e.Column)
+		}
+		if len(e.Expected) != len(v.expected) {
+			t.Errorf("expected %v got %v", v.expected, e.Expected)
+		}
+		if e.Error() != v.msg {
+			t.Errorf("expected %q got %q", v.msg, e.Error())
+		}
+	}
+
+	// the valid lines are still parsed
+	sec, err := a.Section("tigo1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := sec.Get("imei"); v != "352215045819420" {
+		t.Errorf("expected 352215045819420 got %s", v)
+	}
+	buf := &bytes.Buffer{}
+	err = PrintCST(buf, a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != src {
+		t.Errorf("expected %q got %q", src, buf.String())
+	}
+
+	dir := writeFiles(t, map[string]string{"broken.conf": "[broken\n"})
+	defer os.RemoveAll(dir)
+	_, err = ParseFile(dir, "broken.conf", IncludeNone)
+	e, ok = err.(*ParseError)
+	if !ok {
+		t.Fatalf("expected *ParseError got %v", err)
+	}
+	if e.File != filepath.Join(dir, "broken.conf") {
+		t.Errorf("expected the error in broken.conf got %s", e.File)
+	}
+}
+
+func BenchmarkParser(b *testing.B) {
+	src, err := ioutil.ReadFile("../extensions_additional.conf.fastc")
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.SetBytes(int64(len(src)))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		p, err := NewParser(bytes.NewReader(src))
+		if err != nil {
+			b.Fatal(err)
+		}
+		if _, err = p.Parse(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestNewSection(t *testing.T) {
+	a := &Ast{}
+	tpl := NewTemplate("dongle")
+	tpl.Add(NewIdent("context", "from-trunk"))
+	sec := NewSection("dongle0", "dongle")
+	sec.Add(NewIdent("imei", "359000000000001"), NewObject("exten", "s,1,Answer()"))
+	a.Sections = append(a.Sections, tpl, sec)
+
+	var buf bytes.Buffer
+	PrintAst(&buf, a)
+	p, err := NewParser(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, err = p.Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := a.Resolve("dongle0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Name() != "dongle0" || s.Line() == 0 {
+		t.Errorf("expected dongle0 with a line got %s at %d", s.Name(), s.Line())
+	}
+	var got []string
+	for _, v := range s.Values() {
+		got = append(got, v.Key()+v.Operator()+v.Value())
+	}
+	expect := []string{"context=from-trunk", "imei=359000000000001", "exten=>s,1,Answer()"}
+	if len(got) != len(expect) {
+		t.Fatalf("expected %v got %v", expect, got)
+	}
+	for i := range expect {
+		if got[i] != expect[i] {
+			t.Errorf("expected %s got %s", expect[i], got[i])
+		}
+	}
+}
@@ -0,0 +1,332 @@
+package asteriskconf
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"unicode"
+	"unicode/utf8"
+)
+
+const eof = rune(-1)
+
+// Scanner is a lexical scanner for scanning configuration files.
+// This works only on UTF-& text.
+//
+// The whole input is read by the first call to Scan, and every token is a
+// whole lexeme of it: an identifier, a value or a comment is a single token.
+type Scanner struct {
+	r       io.Reader
+	src     []byte
+	currPos int
+	line    int
+	err     error
+	column  int
+
+	// value is true after an assignment operator, the rest of the line up to a
+	// comment is scanned as a single Value token.
+	value bool
+
+	// bol is true when only white space was scanned on the current line.
+	bol bool
+}
+
+// NewScanner takes src and returns a new Scanner.
+func NewScanner(src io.Reader) *Scanner {
+	return &Scanner{
+		r:    src,
+		line: 1,
+		bol:  true,
+	}
+}
+
+//Scan returns a new token for every call by advancing on the consumed UTF-8
+//encoded input text.
+//
+// Anything after ; is considered a comment. White space is preserved together
+// with  new lines. New lines and spaces are interpreted differently.
+//
+// Characters that can not start a token are returned as a token of type
+// Illegal, it is up to the caller to report them.
+func (s *Scanner) Scan() (*Token, error) {
+	if s.r != nil {
+		s.src, s.err = ioutil.ReadAll(s.r)
+		s.r = nil
+	}
+	if s.err != nil {
+		return nil, s.err
+	}
+	ch := s.peek()
+	if s.value {
+		switch ch {
+		case ';', ' ', '\t', '\n', '\r', eof:
+		default:
+			return s.scanValue()
+		}
+	}
+	switch {
+	case ch == '+' && s.peekAt(1) == '=':
+		return s.scanOperator(Append)
+	case ch == '#' && s.bol:
+
+		// # is only special at the beginning of a line
+		return s.scanDirective()
+	case isIdent(ch):
+		return s.scanIdent()
+	}
+	switch ch {
+	case ';':
+		return s.scanComment()
+	case ' ', '\t':
+		return s.scanWhitespace()
+	case '\n', '\r':
+		return s.scanNewline()
+	case '=':
+		if s.peekAt(1) == '>' {
+			return s.scanOperator(Arrow)
+		}
+		s.value = true
+		return s.scanRune(Assign)
+	case '[':
+		return s.scanRune(LBrace)
+	case ']':
+		return s.scanRune(RBrace)
+	case '(':
+		return s.scanRune(LBracket)
+	case ')':
+		return s.scanRune(RBracket)
+	case '!':
+		return s.scanRune(Exclam)
+	case ',':
+		return s.scanRune(Comma)
+	case eof:
+		return nil, io.EOF
+	}
+	return s.scanRune(Illegal)
+}
+
+// scanComment scans the input for Comments.
+//
+// A line comment is all the text from ; up to the end of the line. A block
+// comment starts with ;-- followed by anything but another -, and ends with --;
+// which can be many lines later. Block comments nest, like they do in asterisk.
+// A block comment that is not closed runs up to the end of the input.
+func (s *Scanner) scanComment() (*Token, error) {
+	end := s.currPos
+	depth := 0
+	for end < len(s.src) {
+		switch {
+		case isBlockComment(s.src[end:]):
+			depth++
+			end += 3
+		case depth > 0 && bytes.HasPrefix(s.src[end:], blockEnd):
+			depth--
+			end += len(blockEnd)
+			if depth == 0 {
+				return s.token(Comment, end), nil
+			}
+		case depth == 0 && (s.src[end] == '\n' || s.src[end] == '\r'):
+			return s.token(Comment, end), nil
+		default:
+			end++
+		}
+	}
+	return s.token(Comment, end), nil
+}
+
+var blockEnd = []byte("--;")
+
+// isBlockComment returns true if b starts with the opening of a block comment.
+func isBlockComment(b []byte) bool {
+	return len(b) > 3 && b[0] == ';' && b[1] == '-' && b[2] == '-' && b[3] != '-'
+}
+
+// scanDirective scans a directive like #include or #exec, the returned token
+// holds the whole directive up to the end of the line or the beginning of a
+// comment.
+func (s *Scanner) scanDirective() (*Token, error) {
+	return s.scanText(Directive)
+}
+
+// scanValue scans the value of a definition, which is all the text after the
+// assignment operator up to the end of the line or the beginning of a comment.
+// An escaped semicolon \; does not start a comment, it is part of the value.
+func (s *Scanner) scanValue() (*Token, error) {
+	s.value = false
+	return s.scanText(Value)
+}
+
+// scanText returns a token of type typ with the text up to the end of the line
+// or the first semicolon that is not escaped with a backslash. The white space
+// before the end of the text is not part of the token, it is returned by the
+// next call to Scan.
+func (s *Scanner) scanText(typ TokenType) (*Token, error) {
+	last := s.currPos
+	escaped := false
+END:
+	for end := s.currPos; end < len(s.src); end++ {
+		switch s.src[end] {
+		case '\n', '\r':
+			break END
+		case ';':
+			if !escaped {
+				break END
+			}
+		case ' ', '\t':
+			escaped = false
+			continue
+		}
+		escaped = s.src[end] == '\\' && !escaped
+		last = end + 1
+	}
+	return s.token(typ, last), nil
+}
+
+//scanWhitespace scans all utf-8 white space characters until it hits a non
+//whitespace character.
+//
+// Tabs ('\t') and space(' ') all represent white space.
+func (s *Scanner) scanWhitespace() (*Token, error) {
+	end := s.currPos
+	for end < len(s.src) && (s.src[end] == ' ' || s.src[end] == '\t') {
+		end++
+	}
+	return s.token(WhiteSpace, end), nil
+}
+
+//scanNewline returns a token of type NewLine. It is necessary to separate
+//newlines from normal spaces because many configuration files formats make use
+//of new lines.
+//
+// A new line can either be a carriage return( '\r') or a new line
+// character('\n'), a carriage return followed by a new line character is
+// treated as one new line.
+func (s *Scanner) scanNewline() (*Token, error) {
+	end := s.currPos + 1
+	if s.src[s.currPos] == '\r' && s.peekAt(1) == '\n' {
+
+		// windows line endings are a single new line.
+		end++
+	}
+	s.value = false
+	return s.token(NLine, end), nil
+}
+
+//isIdent returns true if ch is a valid identifier
+// valid identifiers are all the printable unicode characters except white
+// space and the characters with a special meaning
+//	semicolon ;
+//	equal sign =
+//	square brackets [ ]
+//	brackets ( )
+//	exclamation mark !
+//	comma ,
+func isIdent(ch rune) bool {
+	switch ch {
+	case ';', '=', '[', ']', '(', ')', '!', ',':
+		return false
+	}
+	if ch < utf8.RuneSelf {
+		return ch > ' ' && ch < utf8.RuneSelf-1
+	}
+	return unicode.IsPrint(ch) && !unicode.IsSpace(ch)
+}
+
+// scanIdent returns the identifier that starts at the current position as a
+// single Ident token.
+//
+// The identifier ends before the first character that is not valid in an
+// identifier, or before += since that is the append operator.
+func (s *Scanner) scanIdent() (*Token, error) {
+	end := s.currPos
+	for end < len(s.src) {
+		ch, size := rune(s.src[end]), 1
+		if ch >= utf8.RuneSelf {
+			ch, size = utf8.DecodeRune(s.src[end:])
+		}
+		if !isIdent(ch) || ch == '+' && s.peekAt(end+1-s.currPos) == '=' {
+			break
+		}
+		end += size
+	}
+	return s.token(Ident, end), nil
+}
+
+// scanRune scans the current rune and returns a token of type typ, whose Text
+// is the scanned character
+//
+// Use this for single character tokens
+func (s *Scanner) scanRune(typ TokenType) (*Token, error) {
+	_, size := utf8.DecodeRune(s.src[s.currPos:])
+	return s.token(typ, s.currPos+size), nil
+}
+
+// scanOperator scans a two characters operator like => or += and returns it as
+// a single token of type typ.
+func (s *Scanner) scanOperator(typ TokenType) (*Token, error) {
+	s.value = true
+	return s.token(typ, s.currPos+2), nil
+}
+
+// token returns a token of type typ for the input from the current position up
+// to end, and advances the position to end.
+//
+// The line of the token is the line where it starts, and the column is the
+// number of the first character of the token in that line, both starting at 1.
+func (s *Scanner) token(typ TokenType, end int) *Token {
+	text := s.src[s.currPos:end]
+	tok := &Token{
+		Type:   typ,
+		Text:   string(text),
+		Line:   s.line,
+		Column: s.column + 1,
+		Begin:  s.currPos,
+		End:    end,
+	}
+	s.currPos = end
+	switch typ {
+	case NLine:
+		s.line++
+		s.column = 0
+	case Comment:
+
+		// block comments can span many lines
+		if i := bytes.LastIndexAny(text, "\r\n"); i != -1 {
+			s.line += bytes.Count(text, []byte("\n")) + bytes.Count(text, []byte("\r")) -
+				bytes.Count(text, []byte("\r\n"))
+			s.column = utf8.RuneCount(text[i+1:])
+			break
+		}
+		fallthrough
+	default:
+		s.column += utf8.RuneCount(text)
+	}
+	s.bol = typ == NLine || typ == WhiteSpace && s.bol
+	return tok
+}
+
+// peek returns the next rune in the input buffer but does not advance the
+// position of the current buffer.
+//
+// This is a safe way to peek at the next  rune character without actually
+// reading it.
+func (s *Scanner) peek() rune {
+	if s.currPos >= len(s.src) {
+		return eof
+	}
+	if ch := s.src[s.currPos]; ch < utf8.RuneSelf {
+		return rune(ch)
+	}
+	ch, _ := utf8.DecodeRune(s.src[s.currPos:])
+	return ch
+}
+
+// peekAt returns the ASCII character that is n bytes ahead of the next rune in
+// the input buffer, without advancing the position of the current buffer. It
+// returns eof if there is no such character.
+func (s *Scanner) peekAt(n int) rune {
+	if s.currPos+n >= len(s.src) {
+		return eof
+	}
+	return rune(s.src[s.currPos+n])
+}
@@ -0,0 +1,250 @@
+package asteriskconf
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestScanner(t *testing.T) {
+	src := `
+	[section]
+	foo=bar
+	number=1234
+	phone_number=+1234
+
+	; this is a comment
+
+	[section2]
+	foo-dash=bar
+	`
+	lines := map[int]string{
+		2:  "\t[section]",
+		3:  "\tfoo=bar",
+		4:  "\tnumber=1234",
+		5:  "\tphone_number=+1234",
+		7:  "\t; this is a comment",
+		9:  "\t[section2]",
+		10: "\tfoo-dash=bar",
+	}
+	s := NewScanner(strings.NewReader(src))
+	var tok *Token
+	var err error
+	for err == nil {
+		tok, err = s.Scan()
+		if err != nil {
+			if err.Error() != io.EOF.Error() {
+				t.Fatal(err)
+			}
+		}
+		if tok != nil {
+			//fmt.Println(tok.Line, ":", tok.Column, " ", tok.Text)
+
+			if src[tok.Begin:tok.End] != tok.Text {
+				t.Errorf("expected %s at %d got %s", tok.Text, tok.Begin, src[tok.Begin:tok.End])
+			}
+			v, ok := lines[tok.Line]
+			if !ok || tok.Type == NLine {
+				continue
+			}
+			if tok.Type == Comment {
+				if tok.Text != "; this is a comment" {
+					t.Errorf("expected comment  %s got %s", v, tok.Text)
+				}
+				continue
+			}
+			expect := expectText(v, tok)
+			if tok.Text != expect {
+				t.Errorf("expected %s fot %s", expect, tok.Text)
+			}
+		}
+	}
+}
+
+// expectText returns the text expected for tok, which is found at the column of
+// tok in the line v. Values are scanned whole, up to the end of the line, and
+// identifiers up to the first character that is not part of an identifier.
+func expectText(v string, tok *Token) string {
+	switch tok.Type {
+	case Value:
+		return v[tok.Column-1:]
+	case WhiteSpace:
+		return "\t"
+	case Ident:
+		rest := v[tok.Column-1:]
+		if i := strings.IndexAny(rest, "=[]"); i != -1 {
+			return rest[:i]
+		}
+		return rest
+	}
+	return string(v[tok.Column-1])
+}
+
+func TestScanBlockComments(t *testing.T) {
+	src := `[section-name]
+setting=true
+;-- this is a block comment that begins on this line
+and continues across multiple lines, until we
+get to here --;`
+
+	s := NewScanner(strings.NewReader(src))
+	var tok *Token
+	var err error
+	for err == nil {
+		tok, err = s.Scan()
+		if err != nil {
+			if err.Error() != io.EOF.Error() {
+				t.Fatal(err)
+			}
+		}
+		if tok != nil {
+			txt := string(src[tok.Begin:tok.End])
+			if txt != tok.Text {
+				t.Errorf("expected %s got %s", tok.Text, txt)
+			}
+		}
+	}
+}
+
+func TestScanNestedComments(t *testing.T) {
+	src := "a=1 ;-- outer ;-- inner --; still\ncomment --; b\n" +
+		";--- not a block\n" +
+		"c=2\n"
+	expect := []struct {
+		typ  TokenType
+		text string
+		line int
+	}{
+		{Ident, "a", 1},
+		{Value, "1", 1},
+		{Comment, ";-- outer ;-- inner --; still\ncomment --;", 1},
+		{Ident, "b", 2},
+		{Comment, ";--- not a block", 3},
+		{Ident, "c", 4},
+		{Value, "2", 4},
+	}
+	s := NewScanner(strings.NewReader(src))
+	var toks []*Token
+	for {
+		tok, err := s.Scan()
+		if err != nil {
+			if err.Error() != io.EOF.Error() {
+				t.Fatal(err)
+			}
+			break
+		}
+		switch tok.Type {
+		case Ident, Value, Comment:
+			toks = append(toks, tok)
+		}
+	}
+	if len(toks) != len(expect) {
+		t.Fatalf("expected %d tokens got %d", len(expect), len(toks))
+	}
+	for i, v := range expect {
+		if toks[i].Type != v.typ || toks[i].Text != v.text {
+			t.Errorf("expected %s %q got %s %q", v.typ, v.text, toks[i].Type, toks[i].Text)
+		}
+		if toks[i].Line != v.line {
+			t.Errorf("expected %q at line %d got %d", v.text, v.line, toks[i].Line)
+		}
+	}
+}
+
+func TestScanIdents(t *testing.T) {
+	src := "[ général ]\nphone_number+=+255\nsip-peer(!)=x\n"
+	var idents []string
+	s := NewScanner(strings.NewReader(src))
+	for {
+		tok, err := s.Scan()
+		if err != nil {
+			if err.Error() != io.EOF.Error() {
+				t.Fatal(err)
+			}
+			break
+		}
+		if src[tok.Begin:tok.End] != tok.Text {
+			t.Errorf("expected %q got %q", tok.Text, src[tok.Begin:tok.End])
+		}
+		if tok.Type == Ident {
+			idents = append(idents, tok.Text)
+		}
+	}
+	expect := []string{"général", "phone_number", "sip-peer"}
+	if strings.Join(idents, " ") != strings.Join(expect, " ") {
+		t.Errorf("expected %v got %v", expect, idents)
+	}
+}
+
+func BenchmarkScanner(b *testing.B) {
+	src, err := ioutil.ReadFile("../extensions_additional.conf.fastc")
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.SetBytes(int64(len(src)))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		s := NewScanner(bytes.NewReader(src))
+		for {
+			_, err := s.Scan()
+			if err != nil {
+				if err != io.EOF {
+					b.Fatal(err)
+				}
+				break
+			}
+		}
+	}
+}
+
+func TestScanValues(t *testing.T) {
+	src := "audio=/dev/ttyUSB1 ; tty port\n" +
+		"OUT_1 = IAX2/ipkall\n" +
+		"exten => s,1(check),GotoIf($[\"${BLACKLIST()}\"=\"1\"]?blacklisted)\n" +
+		"escaped=a\\;b;comment\n" +
+		"empty = \n" +
+		"#include globals_custom.conf ; custom\n" +
+		"key#=x\n"
+	expect := []struct {
+		typ  TokenType
+		text string
+	}{
+		{Value, "/dev/ttyUSB1"},
+		{Comment, "; tty port"},
+		{Value, "IAX2/ipkall"},
+		{Value, `s,1(check),GotoIf($["${BLACKLIST()}"="1"]?blacklisted)`},
+		{Value, `a\;b`},
+		{Comment, ";comment"},
+		{Directive, "#include globals_custom.conf"},
+		{Comment, "; custom"},
+		{Value, "x"},
+	}
+	s := NewScanner(strings.NewReader(src))
+	var toks []*Token
+	for {
+		tok, err := s.Scan()
+		if err != nil {
+			if err.Error() != io.EOF.Error() {
+				t.Fatal(err)
+			}
+			break
+		}
+		if src[tok.Begin:tok.End] != tok.Text {
+			t.Errorf("expected %q got %q", tok.Text, src[tok.Begin:tok.End])
+		}
+		switch tok.Type {
+		case Value, Comment, Directive:
+			toks = append(toks, tok)
+		}
+	}
+	if len(toks) != len(expect) {
+		t.Fatalf("expected %d tokens got %d", len(expect), len(toks))
+	}
+	for i, v := range expect {
+		if toks[i].Type != v.typ || toks[i].Text != v.text {
+			t.Errorf("expected %q got %q", v.text, toks[i].Text)
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package asteriskconf
+
+// TokenType is the type of tokem that will be returned by the Scanner.
+type TokenType int
+
+// The following are the token types that are recognized by the scanner
+const (
+	EOF TokenType = iota
+	Comment
+	Section
+	WhiteSpace
+	NLine
+	Ident
+	Assign   // =
+	Arrow    // =>
+	Append   // +=
+	LBrace   // [
+	RBrace   // ]
+	LBracket // )
+	RBracket // (
+	Exclam   // !
+	Comma    // ,
+	Directive
+	Value
+	Illegal
+)
+
+var tokenNames = map[TokenType]string{
+	EOF:        "end of file",
+	Comment:    "comment",
+	Section:    "section",
+	WhiteSpace: "white space",
+	NLine:      "new line",
+	Ident:      "identifier",
+	Assign:     "=",
+	Arrow:      "=>",
+	Append:     "+=",
+	LBrace:     "[",
+	RBrace:     "]",
+	LBracket:   "(",
+	RBracket:   ")",
+	Exclam:     "!",
+	Comma:      ",",
+	Directive:  "directive",
+	Value:      "value",
+	Illegal:    "illegal character",
+}
+
+// String returns a human readable name of the token type.
+func (t TokenType) String() string {
+	if name, ok := tokenNames[t]; ok {
+		return name
+	}
+	return "unknown token"
+}
+
+// Token is the identifier for a chunk of text.
+type Token struct {
+	Type   TokenType
+	Text   string
+	Line   int
+	Column int
+	Begin  int
+	End    int
+}
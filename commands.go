@@ -1,16 +1,16 @@
 package main
 
 import (
-	"bufio"
 	"bytes"
-	"encoding/json"
 	"errors"
 	"fmt"
 	"html/template"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"strings"
 
+	"github.com/FarmRadioHangar/fastc/asteriskconf"
 	"github.com/urfave/cli"
 )
 
@@ -20,195 +20,466 @@ const (
 	diaplanOut = "extensions_additional.conf"
 )
 
-type DongleConfig map[string]map[string]interface{}
-
-func ToAST(c DongleConfig) *Ast {
-	a := &Ast{}
-	for k, v := range c {
-		s := &NodeSection{name: k}
-		if imsi, ok := v["imsi"]; ok {
-			s.values = append(s.values, &nodeIdent{
-				key:   "imsi",
-				value: fmt.Sprint(imsi),
-			})
-		}
-		if rx, ok := v["rx-gain"]; ok {
-			s.values = append(s.values, &nodeIdent{
-				key:   "rx-gain",
-				value: fmt.Sprint(rx),
-			})
-		}
-		if tx, ok := v["tx-gain"]; ok {
-			s.values = append(s.values, &nodeIdent{
-				key:   "tx-gain",
-				value: fmt.Sprint(tx),
-			})
+// ToAST returns the sections for c, the [general] section and the [defaults]
+// template come first when they are set, followed by the dongles.
+func ToAST(c *Config) *asteriskconf.Ast {
+	a := &asteriskconf.Ast{}
+	add := func(name string, opts [][2]string) {
+		s := asteriskconf.NewSection(name)
+		for _, opt := range opts {
+			s.Add(asteriskconf.NewIdent(opt[0], opt[1]))
 		}
-
 		a.Sections = append(a.Sections, s)
 	}
+	if c.General != nil {
+		add(generalSection, c.General.Options())
+	}
+	if c.Defaults != nil {
+		add(defaultsSection, c.Defaults.Options())
+	}
+	for _, v := range c.Dongles {
+		add(v.Name, v.Options())
+	}
 	return a
 }
 
 func Dongles(ctx *cli.Context) error {
-	src := ctx.Args().First()
-	var b []byte
-	var err error
-	if src == "stdin" {
-		b, err = ReadFromStdin()
-		if err != nil {
-			return err
-		}
-	} else {
-		if src == "" {
-			return errors.New("either supply a config file or pip stuff to stdin")
-		}
-		b, err = ioutil.ReadFile(src)
-		if err != nil {
-			return err
-		}
-	}
-	c := make(DongleConfig)
-	err = json.Unmarshal(b, &c)
+	b, err := readInput(ctx)
 	if err != nil {
 		return err
 	}
-	a := ToAST(c)
-	// o, err := PatchAst(a)
-	// if err != nil {
-	// 	return err
-	// }
-	var buf bytes.Buffer
-	PrintAst(&buf, a)
-	err = ioutil.WriteFile(filepath.Join(asteriskDir(), dongleFile),
-		buf.Bytes(), 0644,
-	)
+	c, err := decodeDongleInput(b)
 	if err != nil {
 		return err
 	}
-	var tctx []map[string]interface{}
-	for _, v := range c {
-		if calls, ok := v["calls_out"]; ok {
-			not := calls.(string) != "disabled"
-			if not {
-				v["notDisabled"] = not
-			}
-		}
-		tctx = append(tctx, v)
+	files, err := dongleFiles(c)
+	if err != nil {
+		return err
 	}
-	return writeDialPlan(&TemplateContext{Dongles: tctx})
+	return applyFiles(ctx, files, dongleReload)
 }
 
-func PatchAst(dst *Ast) (*Ast, error) {
-	name := filepath.Join(asteriskDir(), dongleFile)
-	b, err := ioutil.ReadFile(name)
+// dongleFiles returns the dongle configuration file and the dialplan for c.
+// The sections and the dialplan entries follow the order of c.Dongles, so the
+// same configuration always gives the same files.
+func dongleFiles(c *Config) (*fileSet, error) {
+	a, err := readDongles()
+	if err != nil {
+		return nil, err
+	}
+	err = PatchAst(a, ToAST(c))
 	if err != nil {
 		return nil, err
 	}
-	p, err := NewParser(bytes.NewReader(b))
+	err = dropLegacyOptions(a, c.Dongles)
 	if err != nil {
 		return nil, err
 	}
+	var buf bytes.Buffer
+	err = asteriskconf.PrintCST(&buf, a)
+	if err != nil {
+		return nil, err
+	}
+	files := newFileSet(asteriskDir())
+	files.add(dongleFile, buf.Bytes(), 0644)
+	tctx := []map[string]interface{}{}
+	for _, v := range c.Dongles {
+		tctx = append(tctx, v.templateData())
+	}
+	err = addDialPlan(files, func(ctx *TemplateContext) error {
+		ctx.Dongles = tctx
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return files, nil
+}
 
-	a, err := p.Parse()
+// Sip configures the sip trunks with json. The chan_sip trunks are written to
+// sip_fessbox.conf and their registrations to sip_registrations_fessbox.conf,
+// the pjsip trunks to pjsip_fessbox.conf, and all of them are added to the
+// outbound routes of the dialplan.
+func Sip(ctx *cli.Context) error {
+	b, err := readInput(ctx)
+	if err != nil {
+		return err
+	}
+	if !isJSON(b) {
+		return errors.New("sip trunks are configured with json")
+	}
+	trunks, err := DecodeSipConfig(trimBOM(b))
+	if err != nil {
+		return err
+	}
+	files, err := sipFiles(trunks)
+	if err != nil {
+		return err
+	}
+	return applyFiles(ctx, files, sipReload)
+}
+
+// sipFiles returns the sip configuration files and the dialplan for trunks.
+func sipFiles(trunks []*SipTrunk) (*fileSet, error) {
+	sip, reg, pjsip, err := SipAST(trunks)
 	if err != nil {
 		return nil, err
 	}
+	files := newFileSet(asteriskDir())
+	for _, v := range []struct {
+		name string
+		a    *asteriskconf.Ast
+	}{
+		{sipFile, sip},
+		{sipRegFile, reg},
+		{pjsipFile, pjsip},
+	} {
+		var buf bytes.Buffer
+		if err = asteriskconf.PrintCST(&buf, v.a); err != nil {
+			return nil, err
+		}
+		// the files hold the trunk secrets.
+		files.add(v.name, buf.Bytes(), 0600)
+	}
+	var tctx []map[string]interface{}
+	for _, v := range trunks {
+		tctx = append(tctx, v.templateData())
+	}
+	err = addDialPlan(files, func(ctx *TemplateContext) error {
+		ctx.Sip = tctx
+		if ctx.Dongles == nil {
+			return checkDongleState()
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return files, nil
+}
 
-	patch := &Ast{}
+// checkDongleState returns an error if the dongle configuration file has
+// dongles while the trunk state has none, like after upgrading from a version
+// of fastc that did not keep them. The dialplan of the dongles can not be
+// rebuilt from the configuration file, which lacks their numbers and calls_out
+// fields, so writing it would drop their outbound routes.
+func checkDongleState() error {
+	a, err := readDongles()
+	if err != nil {
+		return err
+	}
 	for _, s := range a.Sections {
-		for _, v := range dst.Sections {
-			if v.name == s.name {
-				patch.Sections = append(patch.Sections, v)
-			} else {
-				patch.Sections = append(patch.Sections, s)
-			}
+		switch {
+		case s.IsTemplate(), s.Appends(), s.Name() == "main", s.Name() == generalSection, s.Name() == defaultsSection:
+			continue
 		}
+		return fmt.Errorf("the dongles of %s are not in %s yet, run the dongles command first so that they are kept in the dialplan",
+			dongleFile, trunkFile)
 	}
+	return nil
+}
 
-	var buf bytes.Buffer
-	PrintAst(&buf, patch)
-	o := &Ast{}
+// applyFiles writes files, unless the dry-run flag is set. With dry-run the
+// unified diffs of the files that would change are printed instead, and an
+// exit status of 1 is returned if there are any.
+//
+// With the reload flag, asterisk is told to load the written files by running
+// the reload steps through the manager interface.
+func applyFiles(ctx *cli.Context, files *fileSet, reload []amiStep) error {
+	if !ctx.Bool("dry-run") {
+		if err := files.commit(); err != nil {
+			return err
+		}
+		if !ctx.Bool("reload") {
+			return nil
+		}
+		c, err := readManagerConf(asteriskDir(), ctx.String("ami-user"))
+		if err != nil {
+			return err
+		}
+		return reloadAsterisk(ctx.App.Writer, c, reload)
+	}
+	changed, err := files.diff(ctx.App.Writer)
+	if err != nil {
+		return err
+	}
+	if changed {
+		return cli.NewExitError("", 1)
+	}
+	return nil
+}
+
+// PatchAst merges the dongle sections of patch into a, the parsed dongle
+// configuration file.
+//
+// A section of patch updates the section of a holding the same imei, or the
+// section with the same name when there is none. When the matched section has
+// another name, the modem was moved to a new name, like when SIMs are swapped
+// between slots, and the section is renamed. The keys in patch are set, and the
+// chan_dongle options managed by fastc that patch leaves out are removed from
+// the section. The other keys and the sections of a that are not in patch are
+// left as they are. The sections of patch that match nothing are added at the
+// end of a.
+//
+// An error of type IMEICollisions is returned when an imei ends up in more than
+// one section.
+func PatchAst(a, patch *asteriskconf.Ast) error {
+	if err := checkIMEI(patch); err != nil {
+		return err
+	}
+	matched := make(map[*asteriskconf.NodeSection]*asteriskconf.NodeSection)
+	var renamed []*asteriskconf.NodeSection
 	for _, v := range patch.Sections {
-		for _, i := range v.values {
-			if i.key == "imei" {
-				if n := byIMEI(dst, i.value); n != nil {
-					if n.name == v.name {
-						continue
-					}
-					o.Sections = append(o.Sections, n)
-					continue
+		var m *asteriskconf.NodeSection
+		if imei, err := v.Get("imei"); err == nil {
+			m = byIMEI(a, imei)
+		}
+		if m == nil {
+			m = bySection(a, v.Name())
+		}
+		if m == nil {
+			continue
+		}
+		if p, ok := matched[m]; ok {
+			return fmt.Errorf("dongles %s and %s both match section %s",
+				p.Name(), v.Name(), m.Name())
+		}
+		matched[m] = v
+		if m.Name() != v.Name() {
+			renamed = append(renamed, m)
+		}
+	}
+	for _, m := range renamed {
+		name := matched[m].Name()
+		if s := bySection(a, name); s != nil && matched[s] == nil {
+			return fmt.Errorf("dongle %s was moved to section %s, which is already used", m.Name(), name)
+		}
+	}
+
+	// moved sections are renamed in two steps, so that sections can swap
+	// their names.
+	for i, m := range renamed {
+		err := a.RenameSection(m.Name(), fmt.Sprintf("fastc-moved-%d", i))
+		if err != nil {
+			return err
+		}
+	}
+	for _, m := range renamed {
+		err := a.RenameSection(m.Name(), matched[m].Name())
+		if err != nil {
+			return err
+		}
+	}
+	for _, v := range patch.Sections {
+		s := bySection(a, v.Name())
+		if s == nil {
+			s = asteriskconf.NewSection(v.Name())
+			if err := a.AddSection(s); err != nil {
+				return err
+			}
+		}
+		set := make(map[string]bool)
+		for _, i := range v.Values() {
+			if err := s.Set(i.Key(), i.Value()); err != nil {
+				return err
+			}
+			set[i.Key()] = true
+		}
+		for _, k := range managedOptions(v.Name()) {
+			if _, err := s.Get(k); err != nil || set[k] {
+				continue
+			}
+			if err := a.DeleteKey(v.Name(), k); err != nil {
+				return err
+			}
+		}
+	}
+	return checkIMEI(a)
+}
+
+// managedOptions returns the names of the chan_dongle options fastc writes in
+// the section name of the dongle configuration file.
+func managedOptions(name string) []string {
+	var o []string
+	if name == generalSection {
+		for _, opt := range generalOptions {
+			o = append(o, opt.conf)
+		}
+		return o
+	}
+	for _, opt := range dongleOptions {
+		if opt.conf != "" {
+			o = append(o, opt.conf)
+		}
+	}
+	return o
+}
+
+// dropLegacyOptions deletes from the sections of dongles the options written by
+// older versions of fastc, when the option replacing them is set.
+func dropLegacyOptions(a *asteriskconf.Ast, dongles []*Dongle) error {
+	for _, v := range dongles {
+		s, err := a.Section(v.Name)
+		if err != nil {
+			return err
+		}
+		for _, opt := range legacyOptions {
+			if _, err = s.Get(opt[1]); err != nil {
+				continue
+			}
+			if _, err = s.Get(opt[0]); err == nil {
+				if err = a.DeleteKey(v.Name, opt[0]); err != nil {
+					return err
 				}
 			}
 		}
-		o.Sections = append(o.Sections, v)
 	}
-	return o, nil
+	return nil
+}
+
+// IMEICollision is an imei that is found in more than one section.
+type IMEICollision struct {
+	IMEI     string
+	Sections []string
+}
+
+func (c *IMEICollision) Error() string {
+	return fmt.Sprintf("imei %s is used by %s", c.IMEI, strings.Join(c.Sections, ", "))
+}
+
+// IMEICollisions is a list of *IMEICollision.
+type IMEICollisions []*IMEICollision
+
+func (c IMEICollisions) Error() string {
+	var o []string
+	for _, v := range c {
+		o = append(o, v.Error())
+	}
+	return strings.Join(o, "\n")
+}
+
+// checkIMEI returns an IMEICollisions error if the same imei is defined in more
+// than one section of a.
+func checkIMEI(a *asteriskconf.Ast) error {
+	names := make(map[string][]string)
+	var imeis []string
+	for _, s := range a.Sections {
+		if s.Appends() {
+			continue
+		}
+		imei, err := s.Get("imei")
+		if err != nil {
+			continue
+		}
+		if names[imei] == nil {
+			imeis = append(imeis, imei)
+		}
+		names[imei] = append(names[imei], s.Name())
+	}
+	var o IMEICollisions
+	for _, v := range imeis {
+		if len(names[v]) > 1 {
+			o = append(o, &IMEICollision{IMEI: v, Sections: names[v]})
+		}
+	}
+	if len(o) > 0 {
+		return o
+	}
+	return nil
 }
 
-func byIMEI(a *Ast, imei string) *NodeSection {
+func byIMEI(a *asteriskconf.Ast, imei string) *asteriskconf.NodeSection {
 	for _, s := range a.Sections {
-		for _, v := range s.values {
-			if v.key == "imei" && v.value == imei {
+		if s.Appends() {
+			continue
+		}
+		for _, v := range s.Values() {
+			if v.Key() == "imei" && v.Value() == imei {
 				return s
 			}
 		}
 	}
 	return nil
 }
-func bySection(a *Ast, name string) *NodeSection {
+
+func bySection(a *asteriskconf.Ast, name string) *asteriskconf.NodeSection {
 	for _, s := range a.Sections {
-		if s.name == name {
+		if s.Name() == name {
 			return s
 		}
 	}
 	return nil
 }
 
-func asteriskDir() string {
-	if dir := os.Getenv("ASTERISK_CONFIG"); dir != "" {
-		return dir
+// readDongles parses the dongle configuration file generated by fastc. An empty
+// *Ast is returned if the file does not exist yet.
+func readDongles() (*asteriskconf.Ast, error) {
+	a, err := asteriskconf.ParseFile(asteriskDir(), dongleFile, asteriskconf.IncludeNone)
+	if os.IsNotExist(err) {
+		return &asteriskconf.Ast{}, nil
 	}
-	return "/etc/asterisk"
+	return a, err
 }
 
-func ReadFromStdin() ([]byte, error) {
-	r := bufio.NewReader(os.Stdin)
-	return r.ReadBytes('\n')
+func asteriskDir() string {
+	return asteriskconf.Dir()
 }
 
 type TemplateContext struct {
 	Sip     []map[string]interface{}
 	Dongles []map[string]interface{}
+
+	// trunks are the trunk ids kept between runs.
+	trunks *trunkState
 }
 
+// AssgignTrunk sets the trunkID of the dongles and the sip trunks. A trunk
+// keeps the id it was given in the previous runs, new trunks are given the
+// lowest free id from from.
 func (c *TemplateContext) AssgignTrunk(from int) string {
+	if c.trunks == nil {
+		c.trunks = &trunkState{}
+	}
+
 	// start with dongles
 	var d []map[string]interface{}
 	for _, v := range c.Dongles {
-		v["trunkID"] = from
+		name, _ := v["name"].(string)
+		imei, _ := v["imei"].(string)
+		v = copyData(v)
+		v["trunkID"] = c.trunks.assign("", name, imei, from)
 		d = append(d, v)
-		from++
 	}
 	c.Dongles = d
 
 	var s []map[string]interface{}
 	for _, v := range c.Sip {
-		v["trunkID"] = from
+		name, _ := v["name"].(string)
+		v = copyData(v)
+		v["trunkID"] = c.trunks.assign(sipTrunkType, name, "", from)
 		s = append(s, v)
-		from++
 	}
-	c.Dongles = d
+	c.Sip = s
 	return ""
 }
 
-func astToMap(a *Ast) []map[string]interface{} {
+// copyData returns a copy of the template data v, so that the trunk ids are not
+// kept with the data saved in the trunk state.
+func copyData(v map[string]interface{}) map[string]interface{} {
+	o := make(map[string]interface{}, len(v)+1)
+	for k, val := range v {
+		o[k] = val
+	}
+	return o
+}
+
+func astToMap(a *asteriskconf.Ast) []map[string]interface{} {
 	var o []map[string]interface{}
 	for _, s := range a.Sections {
 		v := make(map[string]interface{})
-		v["name"] = s.name
-		for _, vv := range s.values {
-			v[vv.key] = vv.value
+		v["name"] = s.Name()
+		for _, vv := range s.Values() {
+			v[vv.Key()] = vv.Value()
 		}
 		v["notDisabled"] = true
 		o = append(o, v)
@@ -216,11 +487,28 @@ func astToMap(a *Ast) []map[string]interface{} {
 	return o
 }
 
-func writeDialPlan(ctx *TemplateContext) error {
+// addDialPlan renders the dialplan template and adds it to files, together
+// with the trunk state. The template data of the last runs is loaded from the
+// trunk state, update replaces the part of it that the running command
+// generates before the template is executed.
+func addDialPlan(files *fileSet, update func(ctx *TemplateContext) error) error {
 	b, err := ioutil.ReadFile(filepath.Join(asteriskDir(), diaplanTpl))
 	if err != nil {
 		return err
 	}
+	trunks, err := loadTrunks(asteriskDir())
+	if err != nil {
+		return err
+	}
+	err = trunks.reserveGlobals(b)
+	if err != nil {
+		return err
+	}
+	ctx := &TemplateContext{Dongles: trunks.Dongles, Sip: trunks.Sip, trunks: trunks}
+	if err = update(ctx); err != nil {
+		return err
+	}
+	trunks.Dongles, trunks.Sip = ctx.Dongles, ctx.Sip
 	fm := make(template.FuncMap)
 	fm["AssignTrunk"] = ctx.AssgignTrunk
 	fm["plain"] = func(s string) template.HTML {
@@ -235,5 +523,11 @@ func writeDialPlan(ctx *TemplateContext) error {
 	if err != nil {
 		return err
 	}
-	return ioutil.WriteFile(filepath.Join(asteriskDir(), diaplanOut), o.Bytes(), 0600)
+	state, err := trunks.encode()
+	if err != nil {
+		return err
+	}
+	files.add(diaplanOut, o.Bytes(), 0600)
+	files.add(trunkFile, state, 0644)
+	return nil
 }
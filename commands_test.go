@@ -0,0 +1,304 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/FarmRadioHangar/fastc/asteriskconf"
+)
+
+const donglesConf = `; generated by fastc, hand edits are kept
+
+[airtel1]
+imei=353220047976425
+imsi=640050000000001
+exten=+255686442266 ; hand written
+
+[tigo1]
+imei=352215045819420
+imsi=640020000000002
+
+[spare]
+imei=359000000000009
+`
+
+func parseConf(t *testing.T, src string) *asteriskconf.Ast {
+	p, err := asteriskconf.NewParser(strings.NewReader(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, err := p.Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return a
+}
+
+func patchSection(name string, kv ...string) *asteriskconf.NodeSection {
+	s := asteriskconf.NewSection(name)
+	for i := 0; i+1 < len(kv); i += 2 {
+		s.Add(asteriskconf.NewIdent(kv[i], kv[i+1]))
+	}
+	return s
+}
+
+func TestPatchAst(t *testing.T) {
+	sample := []struct {
+		name   string
+		patch  []*asteriskconf.NodeSection
+		expect string
+	}{
+		{
+			"update by name",
+			[]*asteriskconf.NodeSection{
+				patchSection("airtel1", "imei", "353220047976425", "imsi", "640050000000011",
+					"exten", "+255686442266"),
+			},
+			strings.Replace(donglesConf, "imsi=640050000000001", "imsi=640050000000011", 1),
+		},
+		{
+			"update by imei",
+			[]*asteriskconf.NodeSection{
+				patchSection("tigo1", "imei", "352215045819420", "imsi", "640020000000002",
+					"rxgain", "3"),
+			},
+			strings.Replace(donglesConf, "imsi=640020000000002\n",
+				"imsi=640020000000002\nrxgain=3\n", 1),
+		},
+		{
+			"removed options",
+			[]*asteriskconf.NodeSection{
+				patchSection("airtel1", "imei", "353220047976425"),
+			},
+			strings.Replace(donglesConf,
+				"imsi=640050000000001\nexten=+255686442266 ; hand written\n", "", 1),
+		},
+		{
+			"new modem",
+			[]*asteriskconf.NodeSection{
+				patchSection("vodacom1", "imei", "359000000000001"),
+			},
+			donglesConf + "\n[vodacom1]\nimei=359000000000001\n",
+		},
+		{
+			"moved modem",
+			[]*asteriskconf.NodeSection{
+				patchSection("zantel1", "imei", "352215045819420", "imsi", "640030000000003"),
+			},
+			strings.Replace(donglesConf, "[tigo1]\nimei=352215045819420\nimsi=640020000000002",
+				"[zantel1]\nimei=352215045819420\nimsi=640030000000003", 1),
+		},
+		{
+			"swapped sims",
+			[]*asteriskconf.NodeSection{
+				patchSection("airtel1", "imei", "352215045819420", "imsi", "640050000000001"),
+				patchSection("tigo1", "imei", "353220047976425", "imsi", "640020000000002"),
+			},
+			`; generated by fastc, hand edits are kept
+
+[tigo1]
+imei=353220047976425
+imsi=640020000000002
+
+[airtel1]
+imei=352215045819420
+imsi=640050000000001
+
+[spare]
+imei=359000000000009
+`,
+		},
+	}
+	for _, v := range sample {
+		a := parseConf(t, donglesConf)
+		err := PatchAst(a, &asteriskconf.Ast{Sections: v.patch})
+		if err != nil {
+			t.Errorf("%s: %v", v.name, err)
+			continue
+		}
+		var buf bytes.Buffer
+		if err = asteriskconf.PrintCST(&buf, a); err != nil {
+			t.Fatal(err)
+		}
+		if buf.String() != v.expect {
+			t.Errorf("%s: expected\n%s\ngot\n%s", v.name, v.expect, buf.String())
+		}
+	}
+
+	// the options fastc does not write are kept.
+	a := parseConf(t, "[general]\ninterval=15\njbenable=yes\njbmaxsize=200\n\n"+
+		"[spare]\nimei=359000000000009\nrx-gain=3\nsmsc=+255000000000\n")
+	err := PatchAst(a, &asteriskconf.Ast{Sections: []*asteriskconf.NodeSection{
+		patchSection("general", "interval", "15"),
+		patchSection("spare", "imei", "359000000000009"),
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err = asteriskconf.PrintCST(&buf, a); err != nil {
+		t.Fatal(err)
+	}
+	expect := "[general]\ninterval=15\n\n[spare]\nimei=359000000000009\nrx-gain=3\nsmsc=+255000000000\n"
+	if buf.String() != expect {
+		t.Errorf("expected %q got %q", expect, buf.String())
+	}
+}
+
+func TestPatchAstCollisions(t *testing.T) {
+	sample := []struct {
+		name  string
+		conf  string
+		patch []*asteriskconf.NodeSection
+	}{
+		{
+			"same imei in the patch",
+			donglesConf,
+			[]*asteriskconf.NodeSection{
+				patchSection("vodacom1", "imei", "359000000000001"),
+				patchSection("vodacom2", "imei", "359000000000001"),
+			},
+		},
+		{
+			"same imei in the file",
+			donglesConf + "\n[copy]\nimei=359000000000009\n",
+			[]*asteriskconf.NodeSection{
+				patchSection("airtel1", "imsi", "640050000000011"),
+			},
+		},
+	}
+	for _, v := range sample {
+		a := parseConf(t, v.conf)
+		err := PatchAst(a, &asteriskconf.Ast{Sections: v.patch})
+		c, ok := err.(IMEICollisions)
+		if !ok {
+			t.Errorf("%s: expected IMEICollisions got %v", v.name, err)
+			continue
+		}
+		if len(c) != 1 || len(c[0].Sections) != 2 {
+			t.Errorf("%s: expected one imei in two sections got %v", v.name, c)
+		}
+	}
+
+	a := parseConf(t, donglesConf)
+	err := PatchAst(a, &asteriskconf.Ast{Sections: []*asteriskconf.NodeSection{
+		patchSection("spare", "imei", "352215045819420"),
+	}})
+	if err == nil {
+		t.Error("expected an error when moving a modem to a used section")
+	}
+}
+
+func TestDropLegacyOptions(t *testing.T) {
+	a := parseConf(t, "[airtel1]\nimei=353220047976425\nrx-gain=3\ntx-gain=1\n")
+	gain := 4
+	dongles := []*Dongle{{Name: "airtel1", IMEI: "353220047976425", RxGain: &gain}}
+	if err := PatchAst(a, ToAST(&Config{Dongles: dongles})); err != nil {
+		t.Fatal(err)
+	}
+	if err := dropLegacyOptions(a, dongles); err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := asteriskconf.PrintCST(&buf, a); err != nil {
+		t.Fatal(err)
+	}
+	expect := "[airtel1]\nimei=353220047976425\ntx-gain=1\nrxgain=4\n"
+	if buf.String() != expect {
+		t.Errorf("expected %q got %q", expect, buf.String())
+	}
+}
+
+// asteriskTestDir sets ASTERISK_CONFIG to a new temporary directory holding the
+// dialplan template. The returned function removes the directory and restores
+// ASTERISK_CONFIG.
+func asteriskTestDir(t *testing.T) (string, func()) {
+	dir, err := ioutil.TempDir("", "fastc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tpl, err := ioutil.ReadFile(diaplanTpl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ioutil.WriteFile(filepath.Join(dir, diaplanTpl), tpl, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	env, ok := os.LookupEnv("ASTERISK_CONFIG")
+	os.Setenv("ASTERISK_CONFIG", dir)
+	return dir, func() {
+		if ok {
+			os.Setenv("ASTERISK_CONFIG", env)
+		} else {
+			os.Unsetenv("ASTERISK_CONFIG")
+		}
+		os.RemoveAll(dir)
+	}
+}
+
+func TestWriteDonglesOrder(t *testing.T) {
+	configs := []string{
+		`{
+	"tigo1": {"imei": "352215045819420", "calls_out": "own", "rx-gain": 3},
+	"airtel1": {"imei": "353220047976425", "tx-gain": -2, "calls_out": "any"},
+	"vodacom1": {"audio": "/dev/ttyUSB1", "data": "/dev/ttyUSB2", "exten": "+255700000000"},
+	"general": {"jb-enable": true, "interval": 15}
+}`,
+		`{
+	"general": {"interval": 15, "jb-enable": true},
+	"vodacom1": {"exten": "+255700000000", "data": "/dev/ttyUSB2", "audio": "/dev/ttyUSB1"},
+	"airtel1": {"calls_out": "any", "tx-gain": -2, "imei": "353220047976425"},
+	"tigo1": {"rx-gain": 3, "calls_out": "own", "imei": "352215045819420"}
+}`,
+	}
+	var files [][]byte
+	for _, v := range configs {
+		for i := 0; i < 3; i++ {
+			dir, clean := asteriskTestDir(t)
+			c, err := DecodeConfig([]byte(v))
+			if err != nil {
+				clean()
+				t.Fatal(err)
+			}
+			if err = writeDongles(c); err != nil {
+				clean()
+				t.Fatal(err)
+			}
+			var out []byte
+			for _, name := range []string{dongleFile, diaplanOut, trunkFile} {
+				b, err := ioutil.ReadFile(filepath.Join(dir, name))
+				if err != nil {
+					clean()
+					t.Fatal(err)
+				}
+				out = append(out, b...)
+			}
+			clean()
+			files = append(files, out)
+		}
+	}
+	for i := 1; i < len(files); i++ {
+		if !bytes.Equal(files[0], files[i]) {
+			t.Fatalf("run %d: expected the same files as the first run", i)
+		}
+	}
+	conf := string(files[0])
+	a, b, c := strings.Index(conf, "[airtel1]"), strings.Index(conf, "[tigo1]"), strings.Index(conf, "[vodacom1]")
+	if !(strings.Index(conf, "[general]") < a && a < b && b < c) {
+		t.Errorf("expected the dongles sorted by name after [general]")
+	}
+}
+
+// writeDongles writes the files of the dongles command for c.
+func writeDongles(c *Config) error {
+	files, err := dongleFiles(c)
+	if err != nil {
+		return err
+	}
+	return files.commit()
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// diffContext is the number of unchanged lines shown around the changes of a
+// unified diff.
+const diffContext = 3
+
+// diffOp is a line of an edit script, with its index in the old and the new
+// lines. kind is ' ' for a line found in both, '-' for a removed line and '+'
+// for an added line.
+type diffOp struct {
+	kind byte
+	a, b int
+}
+
+// splitLines splits b into lines, keeping their new lines.
+func splitLines(b []byte) []string {
+	var o []string
+	for len(b) > 0 {
+		i := bytes.IndexByte(b, '\n')
+		if i == -1 {
+			o = append(o, string(b))
+			break
+		}
+		o = append(o, string(b[:i+1]))
+		b = b[i+1:]
+	}
+	return o
+}
+
+// diffLines returns the shortest edit script turning a into b. The lines a and
+// b start and end with are matched first, the rest is diffed with the Myers
+// algorithm.
+func diffLines(a, b []string) []diffOp {
+	pre := 0
+	for pre < len(a) && pre < len(b) && a[pre] == b[pre] {
+		pre++
+	}
+	suf := 0
+	for suf < len(a)-pre && suf < len(b)-pre && a[len(a)-1-suf] == b[len(b)-1-suf] {
+		suf++
+	}
+	var o []diffOp
+	for i := 0; i < pre; i++ {
+		o = append(o, diffOp{' ', i, i})
+	}
+	for _, v := range myers(a[pre:len(a)-suf], b[pre:len(b)-suf]) {
+		o = append(o, diffOp{v.kind, v.a + pre, v.b + pre})
+	}
+	for i := suf; i > 0; i-- {
+		o = append(o, diffOp{' ', len(a) - i, len(b) - i})
+	}
+	return o
+}
+
+// myers returns the shortest edit script turning a into b.
+func myers(a, b []string) []diffOp {
+	n, m := len(a), len(b)
+	max := n + m
+	off := max + 1
+	v := make([]int, 2*max+3)
+	var trace [][]int
+	d := 0
+SEARCH:
+	for ; d <= max; d++ {
+		trace = append(trace, append([]int(nil), v[off-d:off+d+1]...))
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[off+k-1] < v[off+k+1]) {
+				x = v[off+k+1]
+			} else {
+				x = v[off+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[off+k] = x
+			if x >= n && y >= m {
+				break SEARCH
+			}
+		}
+	}
+	var o []diffOp
+	x, y := n, m
+	for ; d > 0; d-- {
+		vs := trace[d]
+		get := func(k int) int { return vs[k+d] }
+		k := x - y
+		prev := k - 1
+		if k == -d || (k != d && get(k-1) < get(k+1)) {
+			prev = k + 1
+		}
+		px := get(prev)
+		py := px - prev
+		for x > px && y > py {
+			x--
+			y--
+			o = append(o, diffOp{' ', x, y})
+		}
+		if x == px {
+			y--
+			o = append(o, diffOp{'+', x, y})
+		} else {
+			x--
+			o = append(o, diffOp{'-', x, y})
+		}
+	}
+	for x > 0 && y > 0 {
+		x--
+		y--
+		o = append(o, diffOp{' ', x, y})
+	}
+	for i, j := 0, len(o)-1; i < j; i, j = i+1, j-1 {
+		o[i], o[j] = o[j], o[i]
+	}
+	return o
+}
+
+// unifiedDiff writes the unified diff between old and new to w, with oldName
+// and newName in the file headers. Nothing is written if they are the same.
+func unifiedDiff(w io.Writer, oldName, newName string, old, new []byte) error {
+	a, b := splitLines(old), splitLines(new)
+	ops := diffLines(a, b)
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "--- %s\n+++ %s\n", oldName, newName)
+	changed := false
+	for i := 0; i < len(ops); {
+		if ops[i].kind == ' ' {
+			i++
+			continue
+		}
+		changed = true
+
+		// a hunk goes from the context before the change to the context after
+		// the last change that is close enough to be shown with it.
+		begin := i - diffContext
+		if begin < 0 {
+			begin = 0
+		}
+		end := i
+		for end < len(ops) {
+			if ops[end].kind != ' ' {
+				end++
+				continue
+			}
+			next := end
+			for next < len(ops) && ops[next].kind == ' ' {
+				next++
+			}
+			if next == len(ops) || next-end > 2*diffContext {
+				end += diffContext
+				if end > len(ops) {
+					end = len(ops)
+				}
+				break
+			}
+			end = next
+		}
+		writeHunk(&buf, a, b, ops[begin:end])
+		i = end
+	}
+	if !changed {
+		return nil
+	}
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// writeHunk writes the lines of ops as a hunk of a unified diff.
+func writeHunk(w *bytes.Buffer, a, b []string, ops []diffOp) {
+	na, nb := 0, 0
+	for _, v := range ops {
+		if v.kind != '+' {
+			na++
+		}
+		if v.kind != '-' {
+			nb++
+		}
+	}
+	fmt.Fprintf(w, "@@ -%s +%s @@\n", hunkRange(ops[0].a, na), hunkRange(ops[0].b, nb))
+	for _, v := range ops {
+		var line string
+		if v.kind == '-' {
+			line = a[v.a]
+		} else {
+			line = b[v.b]
+		}
+		w.WriteByte(v.kind)
+		w.WriteString(line)
+		if !strings.HasSuffix(line, "\n") {
+			w.WriteString("\n\\ No newline at end of file\n")
+		}
+	}
+}
+
+// hunkRange returns the range of a hunk header, for count lines from the line
+// at index begin.
+func hunkRange(begin, count int) string {
+	if count == 0 {
+		return fmt.Sprintf("%d,0", begin)
+	}
+	if count == 1 {
+		return fmt.Sprintf("%d", begin+1)
+	}
+	return fmt.Sprintf("%d,%d", begin+1, count)
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/urfave/cli"
+)
+
+func TestUnifiedDiff(t *testing.T) {
+	sample := []struct {
+		old, new, diff string
+	}{
+		{"a\nb\nc\n", "a\nb\nc\n", ""},
+		{"", "a\nb\n", `--- old
++++ new
+@@ -0,0 +1,2 @@
++a
++b
+`},
+		{"1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n11\n12\n13\n14\n15\n16\n",
+			"1\n2\nthree\n4\n5\n6\n7\n8\n9\n10\n11\n12\n13\n15\n16\nseventeen",
+			`--- old
++++ new
+@@ -1,6 +1,6 @@
+ 1
+ 2
+-3
++three
+ 4
+ 5
+ 6
+@@ -11,6 +11,6 @@
+ 11
+ 12
+ 13
+-14
+ 15
+ 16
++seventeen
+\ No newline at end of file
+`},
+		{"1\n2\n3\n4\n5\n6\n7\n8\n9\n", "1\n2\n3\nfour\n5\n6\n7\n8\n9\nten\n", `--- old
++++ new
+@@ -1,9 +1,10 @@
+ 1
+ 2
+ 3
+-4
++four
+ 5
+ 6
+ 7
+ 8
+ 9
++ten
+`},
+		{"a\nb\nc\n", "a\n", `--- old
++++ new
+@@ -1,3 +1 @@
+ a
+-b
+-c
+`},
+		{"[a]\nx=1\n\n\n", "[a]\nx=1\n", `--- old
++++ new
+@@ -1,4 +1,2 @@
+ [a]
+ x=1
+-
+-
+`},
+		{"a\n", "", `--- old
++++ new
+@@ -1 +0,0 @@
+-a
+`},
+	}
+	for i, v := range sample {
+		var buf bytes.Buffer
+		err := unifiedDiff(&buf, "old", "new", []byte(v.old), []byte(v.new))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if buf.String() != v.diff {
+			t.Errorf("%d: expected\n%s\ngot\n%s", i, v.diff, buf.String())
+		}
+	}
+}
+
+func TestDryRun(t *testing.T) {
+	dir, clean := asteriskTestDir(t)
+	defer clean()
+
+	src := filepath.Join(dir, "dongles.json")
+	err := ioutil.WriteFile(src, []byte(`{"airtel1": {"imei": "353220047976425", "calls_out": "own"}}`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	run := func(args ...string) (string, error) {
+		var buf bytes.Buffer
+		app := newApp()
+		app.Writer = &buf
+		app.ExitErrHandler = func(*cli.Context, error) {}
+		err := app.Run(append([]string{"fastc"}, args...))
+		return buf.String(), err
+	}
+	out, err := run("dongles", "--dry-run", src)
+	if e, ok := err.(cli.ExitCoder); !ok || e.ExitCode() != 1 {
+		t.Errorf("expected exit status 1 got %v", err)
+	}
+	for _, v := range []string{
+		"--- /dev/null\n+++ " + filepath.Join(dir, dongleFile) + "\n",
+		"+[airtel1]\n",
+		"+OUT_19 = AMP:Dongle/airtel1/$OUTNUM$\n",
+	} {
+		if !strings.Contains(out, v) {
+			t.Errorf("expected %q in the diff", v)
+		}
+	}
+	if files := readFiles(t, dir); len(files) != 0 {
+		t.Errorf("expected no file to be written got %v", files)
+	}
+	if _, err = run("dongles", src); err != nil {
+		t.Fatal(err)
+	}
+	out, err = run("dongles", "--diff", src)
+	if err != nil || out != "" {
+		t.Errorf("expected no changes got %v\n%s", err, out)
+	}
+}
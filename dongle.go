@@ -0,0 +1,478 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// The range of the rx-gain and tx-gain of a dongle.
+const (
+	MinGain = -20
+	MaxGain = 20
+)
+
+// outModes are the values accepted for the sms_out and calls_out fields of a
+// dongle.
+var outModes = []string{"own", "any", "disabled"}
+
+var (
+	digits15 = regexp.MustCompile(`^[0-9]{15}$`)
+	e164     = regexp.MustCompile(`^\+[1-9][0-9]{1,14}$`)
+
+	// dongleName are the names accepted for dongles, they are used as section
+	// names and in the dialplan.
+	dongleName = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+)
+
+// Dongle is the configuration of a gsm modem as it is sent to fastc in json.
+// The name of the dongle is its key in the json object.
+//
+// Nil pointers and empty strings are options that are not set, chan_dongle
+// uses the value from the [defaults] template for them.
+type Dongle struct {
+	Name     string
+	Number   string
+	Label    string
+	SMSOut   string
+	CallsOut string
+
+	// the chan_dongle device options, see dongleOptions.
+	Audio           string
+	Data            string
+	IMEI            string
+	IMSI            string
+	Context         string
+	Group           *int
+	RxGain          *int
+	TxGain          *int
+	AutoDeleteSMS   *bool
+	ResetDongle     *bool
+	U2Diag          *int
+	UseCallingPres  *bool
+	CallingPres     string
+	DisableSMS      *bool
+	Language        string
+	SMSAsPDU        *bool
+	MinDTMFGap      *int
+	MinDTMFDuration *int
+	MinDTMFInterval *int
+	CallWaiting     *bool
+	Disable         *bool
+	InitState       string
+	Exten           string
+	DTMF            string
+}
+
+// dongleOption maps a field of the dongle json to the chan_dongle option it
+// sets. Fields with no conf name are only used in the dialplan.
+type dongleOption struct {
+	json  string
+	conf  string
+	field func(d *Dongle) interface{}
+}
+
+// dongleOptions are the fields of the dongle json, the chan_dongle options are
+// in the order they are documented in modem.conf.
+var dongleOptions = []dongleOption{
+	{"name", "", nil},
+	{"number", "", func(d *Dongle) interface{} { return &d.Number }},
+	{"label", "", func(d *Dongle) interface{} { return &d.Label }},
+	{"sms_out", "", func(d *Dongle) interface{} { return &d.SMSOut }},
+	{"calls_out", "", func(d *Dongle) interface{} { return &d.CallsOut }},
+	{"audio", "audio", func(d *Dongle) interface{} { return &d.Audio }},
+	{"data", "data", func(d *Dongle) interface{} { return &d.Data }},
+	{"imei", "imei", func(d *Dongle) interface{} { return &d.IMEI }},
+	{"imsi", "imsi", func(d *Dongle) interface{} { return &d.IMSI }},
+	{"context", "context", func(d *Dongle) interface{} { return &d.Context }},
+	{"group", "group", func(d *Dongle) interface{} { return &d.Group }},
+	{"rx-gain", "rxgain", func(d *Dongle) interface{} { return &d.RxGain }},
+	{"tx-gain", "txgain", func(d *Dongle) interface{} { return &d.TxGain }},
+	{"auto-delete-sms", "autodeletesms", func(d *Dongle) interface{} { return &d.AutoDeleteSMS }},
+	{"reset-dongle", "resetdongle", func(d *Dongle) interface{} { return &d.ResetDongle }},
+	{"u2diag", "u2diag", func(d *Dongle) interface{} { return &d.U2Diag }},
+	{"use-calling-pres", "usecallingpres", func(d *Dongle) interface{} { return &d.UseCallingPres }},
+	{"calling-pres", "callingpres", func(d *Dongle) interface{} { return &d.CallingPres }},
+	{"disable-sms", "disablesms", func(d *Dongle) interface{} { return &d.DisableSMS }},
+	{"language", "language", func(d *Dongle) interface{} { return &d.Language }},
+	{"sms-as-pdu", "smsaspdu", func(d *Dongle) interface{} { return &d.SMSAsPDU }},
+	{"min-dtmf-gap", "mindtmfgap", func(d *Dongle) interface{} { return &d.MinDTMFGap }},
+	{"min-dtmf-duration", "mindtmfduration", func(d *Dongle) interface{} { return &d.MinDTMFDuration }},
+	{"min-dtmf-interval", "mindtmfinterval", func(d *Dongle) interface{} { return &d.MinDTMFInterval }},
+	{"call-waiting", "callwaiting", func(d *Dongle) interface{} { return &d.CallWaiting }},
+	{"disable", "disable", func(d *Dongle) interface{} { return &d.Disable }},
+	{"init-state", "initstate", func(d *Dongle) interface{} { return &d.InitState }},
+	{"exten", "exten", func(d *Dongle) interface{} { return &d.Exten }},
+	{"dtmf", "dtmf", func(d *Dongle) interface{} { return &d.DTMF }},
+}
+
+// legacyOptions are the option names written by older versions of fastc, and
+// the chan_dongle options that replace them.
+var legacyOptions = [][2]string{
+	{"rx-gain", "rxgain"},
+	{"tx-gain", "txgain"},
+}
+
+// The values accepted by the enum options of a dongle.
+var (
+	callingPres = []string{
+		"allowed_not_screened", "allowed_passed_screen", "allowed_failed_screen",
+		"allowed", "prohib_not_screened", "prohib_passed_screen",
+		"prohib_failed_screen", "prohib", "unavailable",
+	}
+	initStates = []string{"start", "stop", "remote", "remove"}
+	dtmfModes  = []string{"off", "inband", "relax"}
+)
+
+// Options returns the chan_dongle options set in d, as their names and values
+// in the dongle configuration file, in the order of dongleOptions.
+func (d *Dongle) Options() [][2]string {
+	var o [][2]string
+	for _, opt := range dongleOptions {
+		if opt.conf == "" {
+			continue
+		}
+		if v, ok := confValue(opt.field(d)); ok {
+			o = append(o, [2]string{opt.conf, v})
+		}
+	}
+	return o
+}
+
+// confValue returns the value of the field f as it is written in asterisk
+// configuration files, and false if the field is not set.
+func confValue(f interface{}) (string, bool) {
+	switch v := f.(type) {
+	case *string:
+		return *v, *v != ""
+	case **int:
+		if *v != nil {
+			return strconv.Itoa(**v), true
+		}
+	case **bool:
+		if *v != nil {
+			if **v {
+				return "yes", true
+			}
+			return "no", true
+		}
+	}
+	return "", false
+}
+
+// FieldError is an invalid field of a dongle. Dongle is the name of the
+// dongle, or general or defaults for the fields of those sections. Kind is
+// empty for the dongle config, and trunk for the fields of a sip trunk.
+type FieldError struct {
+	Kind   string
+	Dongle string
+	Field  string
+	Msg    string
+}
+
+// trunkKind is the Kind of the errors in the sip trunks config.
+const trunkKind = "trunk"
+
+func (e *FieldError) Error() string {
+	name := "dongle " + e.Dongle
+	switch {
+	case e.Kind != "":
+		name = e.Kind + " " + e.Dongle
+	case e.Dongle == generalSection || e.Dongle == defaultsSection:
+		name = e.Dongle
+	}
+	if e.Field == "" {
+		return fmt.Sprintf("%s: %s", name, e.Msg)
+	}
+	return fmt.Sprintf("%s: %s %s", name, e.Field, e.Msg)
+}
+
+// FieldErrors is a list of *FieldError.
+type FieldErrors []*FieldError
+
+func (e FieldErrors) Error() string {
+	var o []string
+	for _, v := range e {
+		o = append(o, v.Error())
+	}
+	return strings.Join(o, "\n")
+}
+
+// The json objects that are not dongles.
+const (
+	generalSection  = "general"
+	defaultsSection = "defaults"
+)
+
+// Config is the json input of the dongles command. It is an object whose keys
+// are the names of the dongles, and optionally the general and defaults objects
+// for the [general] section and the [defaults] template of chan_dongle.
+type Config struct {
+	General  *General
+	Defaults *Dongle
+	Dongles  []*Dongle
+}
+
+// DecodeConfig decodes and validates the json object src. The dongles are
+// returned sorted by name.
+//
+// All the invalid fields are reported together, as a FieldErrors.
+func DecodeConfig(src []byte) (*Config, error) {
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(src, &raw); err != nil {
+		return nil, err
+	}
+	var names []string
+	for k := range raw {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	c := &Config{}
+	var errs FieldErrors
+	for _, name := range names {
+		var obj map[string]json.RawMessage
+		if err := json.Unmarshal(raw[name], &obj); err != nil {
+			errs = append(errs, &FieldError{Dongle: name, Msg: "must be a json object"})
+			continue
+		}
+		var decoded []error
+		switch name {
+		case generalSection:
+			c.General = &General{}
+			decoded = []error{c.General.decode(obj), c.General.Validate()}
+		case defaultsSection:
+			c.Defaults = &Dongle{Name: name}
+			decoded = []error{c.Defaults.decodeDefaults(obj), c.Defaults.validateOptions()}
+		default:
+			d := &Dongle{Name: name}
+			c.Dongles = append(c.Dongles, d)
+			decoded = []error{d.decode(obj), d.Validate()}
+		}
+		for _, err := range decoded {
+			if e, ok := err.(FieldErrors); ok {
+				errs = append(errs, e...)
+			}
+		}
+	}
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	return c, nil
+}
+
+// decode sets the fields of d from the fields of its json object.
+func (d *Dongle) decode(obj map[string]json.RawMessage) error {
+	var name string
+	fields := map[string]interface{}{"name": &name}
+	for _, v := range dongleOptions {
+		if v.field != nil {
+			fields[v.json] = v.field(d)
+		}
+	}
+	errs := decodeFields(d.Name, obj, fields)
+	if name != "" && name != d.Name {
+		errs = append(errs, &FieldError{Dongle: d.Name, Field: "name",
+			Msg: fmt.Sprintf("%q does not match the dongle name", name)})
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// decodeDefaults sets the fields of d from the defaults json object, which
+// accepts only the chan_dongle options that are not specific to a device.
+func (d *Dongle) decodeDefaults(obj map[string]json.RawMessage) error {
+	fields := make(map[string]interface{})
+	for _, v := range dongleOptions {
+		switch v.conf {
+		case "", "audio", "data", "imei", "imsi":
+		default:
+			fields[v.json] = v.field(d)
+		}
+	}
+	if errs := decodeFields(d.Name, obj, fields); len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// decodeFields decodes the fields of the json object obj of the section named
+// name into the values of fields, which are keyed by the json field names.
+func decodeFields(name string, obj map[string]json.RawMessage, fields map[string]interface{}) FieldErrors {
+	var keys []string
+	for k := range obj {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var errs FieldErrors
+	for _, k := range keys {
+		v, ok := fields[k]
+		if !ok {
+			errs = append(errs, &FieldError{Dongle: name, Field: k, Msg: "is not a known field"})
+			continue
+		}
+		if err := json.Unmarshal(obj[k], v); err != nil {
+			msg := "must be a string"
+			switch v.(type) {
+			case **int:
+				msg = "must be an integer"
+			case **bool:
+				msg = "must be true or false"
+			case *[]string:
+				msg = "must be a list of strings"
+			}
+			errs = append(errs, &FieldError{Dongle: name, Field: k, Msg: msg})
+		}
+	}
+	return errs
+}
+
+// Validate checks the fields of d, all the invalid fields are returned as a
+// FieldErrors.
+//
+// The name of the dongle must only have letters, digits, - and _. The device
+// must be found either by its audio and data ports or by its imei or
+// imsi, which must be 15 digits. The gains must be between MinGain and MaxGain,
+// the number must be in E.164 format and sms_out and calls_out must be one of
+// own, any or disabled. The enum options must have one of the values
+// documented in modem.conf. Options that are not set are not checked.
+func (d *Dongle) Validate() error {
+	var errs FieldErrors
+	add := func(field, msg string) {
+		errs = append(errs, &FieldError{Dongle: d.Name, Field: field, Msg: msg})
+	}
+	if !dongleName.MatchString(d.Name) {
+		add("name", "must only have letters, digits, - and _")
+	}
+	switch {
+	case d.Audio != "" && d.Data == "":
+		add("audio", "must be set together with data")
+	case d.Audio == "" && d.Data != "":
+		add("data", "must be set together with audio")
+	case d.Audio == "" && d.IMEI == "" && d.IMSI == "":
+		add("", "needs audio and data, imei or imsi to find the device")
+	}
+	if e, ok := d.validateOptions().(FieldErrors); ok {
+		errs = append(errs, e...)
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// validateOptions checks the fields of d, without requiring the fields that
+// find the device.
+func (d *Dongle) validateOptions() error {
+	var errs FieldErrors
+	add := func(field, msg string) {
+		errs = append(errs, &FieldError{Dongle: d.Name, Field: field, Msg: msg})
+	}
+	if d.IMEI != "" && !digits15.MatchString(d.IMEI) {
+		add("imei", "must be exactly 15 digits")
+	}
+	if d.IMSI != "" && !digits15.MatchString(d.IMSI) {
+		add("imsi", "must be exactly 15 digits")
+	}
+	if d.Number != "" && !e164.MatchString(d.Number) {
+		add("number", "must be in E.164 format, like +255686442266")
+	}
+	for _, v := range []struct {
+		field    string
+		value    *int
+		min, max int
+	}{
+		{"group", d.Group, 0, 63},
+		{"rx-gain", d.RxGain, MinGain, MaxGain},
+		{"tx-gain", d.TxGain, MinGain, MaxGain},
+		{"u2diag", d.U2Diag, -1, 255},
+		{"min-dtmf-gap", d.MinDTMFGap, 0, 10000},
+		{"min-dtmf-duration", d.MinDTMFDuration, 0, 10000},
+		{"min-dtmf-interval", d.MinDTMFInterval, 0, 10000},
+	} {
+		if v.value != nil && (*v.value < v.min || *v.value > v.max) {
+			add(v.field, fmt.Sprintf("must be between %d and %d", v.min, v.max))
+		}
+	}
+	for _, v := range []struct {
+		field  string
+		value  string
+		values []string
+	}{
+		{"sms_out", d.SMSOut, outModes},
+		{"calls_out", d.CallsOut, outModes},
+		{"calling-pres", d.CallingPres, callingPres},
+		{"init-state", d.InitState, initStates},
+		{"dtmf", d.DTMF, dtmfModes},
+	} {
+		if v.value != "" && !oneOf(v.value, v.values) {
+			add(v.field, "must be one of "+strings.Join(v.values, ", "))
+		}
+	}
+	for _, opt := range dongleOptions {
+		if opt.field == nil {
+			continue
+		}
+		if v, ok := opt.field(d).(*string); ok && !isText(*v) {
+			add(opt.json, "must not have control characters or ;")
+		}
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// isText returns true if s can be written as the value of an option. Control
+// characters, like new lines, and ; would change the configuration file around
+// the value.
+func isText(s string) bool {
+	return !strings.Contains(s, ";") && !hasControl(s)
+}
+
+// hasControl returns true if s has control characters, like new lines.
+func hasControl(s string) bool {
+	return strings.IndexFunc(s, unicode.IsControl) != -1
+}
+
+// oneOf returns true if s is in values.
+func oneOf(s string, values []string) bool {
+	for _, v := range values {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// templateData returns the fields of d as they are used by the dialplan
+// template, keyed by their json names.
+func (d *Dongle) templateData() map[string]interface{} {
+	o := map[string]interface{}{"name": d.Name}
+	for _, opt := range dongleOptions {
+		if opt.field == nil {
+			continue
+		}
+		switch v := opt.field(d).(type) {
+		case *string:
+			o[opt.json] = *v
+		case **int:
+			if *v != nil {
+				o[opt.json] = **v
+			}
+		case **bool:
+			if *v != nil {
+				o[opt.json] = **v
+			}
+		}
+	}
+	if d.CallsOut != "" && d.CallsOut != "disabled" {
+		o["notDisabled"] = true
+	}
+	return o
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"io/ioutil"
+	"testing"
+)
+
+func TestDecodeConfig(t *testing.T) {
+	src, err := ioutil.ReadFile("sample.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err := DecodeConfig(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dongles := c.Dongles
+	if len(dongles) != 1 {
+		t.Fatalf("expected 1 dongle got %d", len(dongles))
+	}
+	d := dongles[0]
+	if d.Name != "airtel1" || d.IMEI != "352324524524352" || d.CallsOut != "own" {
+		t.Errorf("unexpected dongle %+v", d)
+	}
+	if d.RxGain == nil || *d.RxGain != 2 || d.TxGain == nil || *d.TxGain != 4 {
+		t.Errorf("expected gains 2 and 4 got %v %v", d.RxGain, d.TxGain)
+	}
+	if data := d.templateData(); data["notDisabled"] != true {
+		t.Errorf("expected airtel1 to be enabled got %v", data["notDisabled"])
+	}
+}
+
+func TestDecodeConfigErrors(t *testing.T) {
+	src := `{
+	"airtel1": {
+		"imei": "35232452452435",
+		"imsi": "64234342324524x",
+		"number": "0686442266",
+		"rx-gain": 2.5,
+		"tx-gain": 40,
+		"sms_out": "everyone",
+		"calls_out": 1
+	},
+	"tigo1": {
+		"name": "tigo2",
+		"imei": "352215045819420",
+		"color": "red"
+	},
+	"vodacom1": "imei",
+	"a${SHELL(touch /tmp/pwn)}": {"imei": "352215045819421"},
+	"mtn1": {
+		"imei": "352215045819422",
+		"context": "ctx\n[evil]\nfoo=bar",
+		"language": "en;fr"
+	}
+}`
+	_, err := DecodeConfig([]byte(src))
+	errs, ok := err.(FieldErrors)
+	if !ok {
+		t.Fatalf("expected FieldErrors got %v", err)
+	}
+	expect := []struct {
+		dongle, field string
+	}{
+		{"a${SHELL(touch /tmp/pwn)}", "name"},
+		{"airtel1", "calls_out"},
+		{"airtel1", "rx-gain"},
+		{"airtel1", "imei"},
+		{"airtel1", "imsi"},
+		{"airtel1", "number"},
+		{"airtel1", "tx-gain"},
+		{"airtel1", "sms_out"},
+		{"mtn1", "context"},
+		{"mtn1", "language"},
+		{"tigo1", "color"},
+		{"tigo1", "name"},
+		{"vodacom1", ""},
+	}
+	if len(errs) != len(expect) {
+		t.Fatalf("expected %d errors got %d: %v", len(expect), len(errs), errs)
+	}
+	for i, v := range expect {
+		if errs[i].Dongle != v.dongle || errs[i].Field != v.field {
+			t.Errorf("expected %s %s got %s", v.dongle, v.field, errs[i])
+		}
+	}
+
+	d := &Dongle{Name: "airtel1", IMEI: "35232452452435", IMSI: "64234342324524x",
+		Number: "0686442266", SMSOut: "everyone"}
+	err = d.Validate()
+	errs, ok = err.(FieldErrors)
+	if !ok || len(errs) != 4 {
+		t.Fatalf("expected 4 errors got %v", err)
+	}
+	for i, v := range []string{"imei", "imsi", "number", "sms_out"} {
+		if errs[i].Field != v {
+			t.Errorf("expected %s got %s", v, errs[i])
+		}
+	}
+}
+
+func TestDongleOptions(t *testing.T) {
+	src := `{
+	"tigo1": {
+		"audio": "/dev/ttyUSB1",
+		"data": "/dev/ttyUSB2",
+		"rx-gain": -2,
+		"auto-delete-sms": true,
+		"call-waiting": false,
+		"init-state": "stop",
+		"dtmf": "inband",
+		"number": "+255686442266"
+	}
+}`
+	c, err := DecodeConfig([]byte(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	dongles := c.Dongles
+	expect := [][2]string{
+		{"audio", "/dev/ttyUSB1"},
+		{"data", "/dev/ttyUSB2"},
+		{"rxgain", "-2"},
+		{"autodeletesms", "yes"},
+		{"callwaiting", "no"},
+		{"initstate", "stop"},
+		{"dtmf", "inband"},
+	}
+	opts := dongles[0].Options()
+	if len(opts) != len(expect) {
+		t.Fatalf("expected %v got %v", expect, opts)
+	}
+	for i, v := range expect {
+		if opts[i] != v {
+			t.Errorf("expected %v got %v", v, opts[i])
+		}
+	}
+
+	invalid := []struct {
+		dongle *Dongle
+		field  string
+	}{
+		{&Dongle{Name: "a"}, ""},
+		{&Dongle{Name: "a", Audio: "/dev/ttyUSB1"}, "audio"},
+		{&Dongle{Name: "a", Data: "/dev/ttyUSB2"}, "data"},
+		{&Dongle{Name: "a", IMSI: "640021046580298", DTMF: "loud"}, "dtmf"},
+		{&Dongle{Name: "a", IMSI: "640021046580298", InitState: "on"}, "init-state"},
+		{&Dongle{Name: "a", IMSI: "640021046580298", CallingPres: "hidden"}, "calling-pres"},
+	}
+	for _, v := range invalid {
+		errs, ok := v.dongle.Validate().(FieldErrors)
+		if !ok || len(errs) != 1 || errs[0].Field != v.field {
+			t.Errorf("expected an error for %q got %v", v.field, errs)
+		}
+	}
+}
@@ -0,0 +1,402 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/urfave/cli"
+)
+
+const (
+	// backupDir is the directory, in the asterisk configuration directory,
+	// holding the backups of the files written by fastc.
+	backupDir = "fastc_backups"
+
+	// maxBackups is the number of backups that are kept, the oldest ones are
+	// removed first.
+	maxBackups = 10
+
+	// backupManifest is the file in a backup listing the files it restores.
+	backupManifest = "manifest.json"
+
+	// backupTime is the layout of the names of the backups, which sort in the
+	// order they were made.
+	backupTime = "20060102T150405.000000000"
+)
+
+// generatedFiles are the files written by fastc. They are backed up together
+// before any of them is changed, so that rolling back restores a set of files
+// that were written by the same runs.
+var generatedFiles = []string{
+	dongleFile,
+	sipFile,
+	sipRegFile,
+	pjsipFile,
+	diaplanOut,
+	trunkFile,
+}
+
+// fileSet is a set of changes to the files of a directory that are applied
+// together.
+type fileSet struct {
+	dir   string
+	files []*setFile
+
+	// backup is true if the generated files are backed up before the changes
+	// are applied.
+	backup bool
+}
+
+// setFile is a change to a file of a fileSet, the file is removed when remove
+// is true.
+type setFile struct {
+	name   string
+	data   []byte
+	perm   os.FileMode
+	remove bool
+}
+
+func newFileSet(dir string) *fileSet {
+	return &fileSet{dir: dir, backup: true}
+}
+
+// add sets the content of the file name to data.
+func (s *fileSet) add(name string, data []byte, perm os.FileMode) {
+	s.files = append(s.files, &setFile{name: name, data: data, perm: perm})
+}
+
+// replaceFile returns a fileSet that replaces the file at path with the
+// content returned by data, which is called with the path of the replaced
+// file. The permissions are kept, and a symbolic link is followed, so that the
+// file it points to is the one replaced. The generated files are not backed up,
+// as the replaced file is not one of them.
+func replaceFile(path string, data func(path string) ([]byte, error)) (*fileSet, error) {
+	path, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return nil, err
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	b, err := data(path)
+	if err != nil {
+		return nil, err
+	}
+	files := &fileSet{dir: filepath.Dir(path)}
+	files.add(filepath.Base(path), b, info.Mode().Perm())
+	return files, nil
+}
+
+// remove removes the file name, if it exists.
+func (s *fileSet) remove(name string) {
+	s.files = append(s.files, &setFile{name: name, remove: true})
+}
+
+// commit applies the changes of s. The new contents are written to temporary
+// files that are renamed to the files they replace, after the generated files
+// are backed up. If a rename fails, the files that were already replaced are
+// restored from the backup.
+//
+// Nothing is written, and no backup is made, when the changes leave every file
+// as it is.
+func (s *fileSet) commit() (err error) {
+	changed := false
+	for _, v := range s.files {
+		same, err := v.same(s.dir)
+		if err != nil {
+			return err
+		}
+		if !same {
+			changed = true
+			break
+		}
+	}
+	if !changed {
+		return nil
+	}
+	tmps := make(map[*setFile]string)
+	defer func() {
+		for _, v := range tmps {
+			os.Remove(v)
+		}
+	}()
+	for _, v := range s.files {
+		if v.remove {
+			continue
+		}
+		tmp, err := writeTemp(s.dir, v.name, v.data, v.perm)
+		if err != nil {
+			return err
+		}
+		tmps[v] = tmp
+	}
+	var backup string
+	if s.backup {
+		backup, err = makeBackup(s.dir, time.Now())
+		if err != nil {
+			return err
+		}
+	}
+	for _, v := range s.files {
+		target := filepath.Join(s.dir, v.name)
+		if v.remove {
+			err = os.Remove(target)
+			if os.IsNotExist(err) {
+				err = nil
+			}
+		} else {
+			err = os.Rename(tmps[v], target)
+			delete(tmps, v)
+		}
+		if err != nil {
+			if backup != "" {
+				restoreBackup(s.dir, backup)
+			}
+			return err
+		}
+	}
+	if s.backup {
+		return pruneBackups(s.dir)
+	}
+	return nil
+}
+
+// same returns true if the file of f in dir already is as f would leave it.
+func (f *setFile) same(dir string) (bool, error) {
+	path := filepath.Join(dir, f.name)
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return f.remove, nil
+	}
+	if err != nil || f.remove {
+		return false, err
+	}
+	if info.Mode().Perm() != f.perm {
+		return false, nil
+	}
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return false, err
+	}
+	return bytes.Equal(b, f.data), nil
+}
+
+// diff writes to w the unified diffs between the files of the directory and the
+// files as they would be after commit, and returns true if any file would
+// change.
+func (s *fileSet) diff(w io.Writer) (bool, error) {
+	changed := false
+	for _, v := range s.files {
+		path := filepath.Join(s.dir, v.name)
+		oldName, newName := path, path
+		old, err := ioutil.ReadFile(path)
+		switch {
+		case os.IsNotExist(err):
+			if v.remove {
+				continue
+			}
+			oldName = "/dev/null"
+		case err != nil:
+			return false, err
+		case v.remove:
+			newName = "/dev/null"
+		}
+		if err == nil && !v.remove && bytes.Equal(old, v.data) {
+			continue
+		}
+		changed = true
+		if err = unifiedDiff(w, oldName, newName, old, v.data); err != nil {
+			return false, err
+		}
+	}
+	return changed, nil
+}
+
+// writeTemp writes data to a new temporary file next to the file name in dir,
+// and returns the path of the temporary file.
+func writeTemp(dir, name string, data []byte, perm os.FileMode) (string, error) {
+	f, err := ioutil.TempFile(dir, "."+name+".")
+	if err != nil {
+		return "", err
+	}
+	_, err = f.Write(data)
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Chmod(f.Name(), perm)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+	return f.Name(), nil
+}
+
+// manifest lists the generated files when a backup was made. Missing are the
+// files that did not exist, they are removed when the backup is restored.
+type manifest struct {
+	Files   []string `json:"files"`
+	Missing []string `json:"missing,omitempty"`
+}
+
+// makeBackup copies the generated files of dir to a new backup named after
+// now, and returns the path of the backup. The backup is written to a temporary
+// directory that is renamed when it is complete.
+func makeBackup(dir string, now time.Time) (string, error) {
+	root := filepath.Join(dir, backupDir)
+	if err := os.MkdirAll(root, 0755); err != nil {
+		return "", err
+	}
+	tmp, err := ioutil.TempDir(root, ".backup")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(tmp)
+	m := &manifest{}
+	for _, name := range generatedFiles {
+		src := filepath.Join(dir, name)
+		info, err := os.Stat(src)
+		if os.IsNotExist(err) {
+			m.Missing = append(m.Missing, name)
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+		b, err := ioutil.ReadFile(src)
+		if err != nil {
+			return "", err
+		}
+		err = ioutil.WriteFile(filepath.Join(tmp, name), b, info.Mode().Perm())
+		if err != nil {
+			return "", err
+		}
+		m.Files = append(m.Files, name)
+	}
+	b, err := json.MarshalIndent(m, "", "\t")
+	if err != nil {
+		return "", err
+	}
+	err = ioutil.WriteFile(filepath.Join(tmp, backupManifest), b, 0644)
+	if err != nil {
+		return "", err
+	}
+	path := filepath.Join(root, now.UTC().Format(backupTime))
+	if err = os.Rename(tmp, path); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// backups returns the names of the backups of dir, from the oldest to the most
+// recent one.
+func backups(dir string) ([]string, error) {
+	infos, err := ioutil.ReadDir(filepath.Join(dir, backupDir))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var o []string
+	for _, v := range infos {
+		if v.IsDir() && !strings.HasPrefix(v.Name(), ".") {
+			o = append(o, v.Name())
+		}
+	}
+	sort.Strings(o)
+	return o, nil
+}
+
+// pruneBackups removes the oldest backups of dir, keeping maxBackups of them.
+func pruneBackups(dir string) error {
+	names, err := backups(dir)
+	if err != nil {
+		return err
+	}
+	for len(names) > maxBackups {
+		err = os.RemoveAll(filepath.Join(dir, backupDir, names[0]))
+		if err != nil {
+			return err
+		}
+		names = names[1:]
+	}
+	return nil
+}
+
+// restoreBackup restores the generated files of dir from the backup at path.
+// The files that did not exist when the backup was made are removed.
+func restoreBackup(dir, path string) error {
+	b, err := ioutil.ReadFile(filepath.Join(path, backupManifest))
+	if err != nil {
+		return err
+	}
+	m := &manifest{}
+	if err = json.Unmarshal(b, m); err != nil {
+		return err
+	}
+	s := &fileSet{dir: dir}
+	for _, name := range m.Files {
+		src := filepath.Join(path, name)
+		info, err := os.Stat(src)
+		if err != nil {
+			return err
+		}
+		b, err := ioutil.ReadFile(src)
+		if err != nil {
+			return err
+		}
+		s.add(name, b, info.Mode().Perm())
+	}
+	for _, name := range m.Missing {
+		s.remove(name)
+	}
+	return s.commit()
+}
+
+// rollback restores the most recent backup of dir and removes it, so that
+// rolling back again restores the backup before it.
+func rollback(dir string) (string, error) {
+	names, err := backups(dir)
+	if err != nil {
+		return "", err
+	}
+	if len(names) == 0 {
+		return "", errors.New("there is no backup to roll back to")
+	}
+	name := names[len(names)-1]
+	path := filepath.Join(dir, backupDir, name)
+	if err = restoreBackup(dir, path); err != nil {
+		return "", err
+	}
+	return name, os.RemoveAll(path)
+}
+
+// Rollback restores the files written by fastc to their state before the last
+// run that changed them.
+func Rollback(ctx *cli.Context) error {
+	name, err := rollback(asteriskDir())
+	if err != nil {
+		return err
+	}
+	t, err := time.Parse(backupTime, name)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(ctx.App.Writer, "restored the files from %s\n", t.Local().Format(time.RFC3339))
+	return nil
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func readFiles(t *testing.T, dir string) map[string]string {
+	o := make(map[string]string)
+	for _, name := range generatedFiles {
+		b, err := ioutil.ReadFile(filepath.Join(dir, name))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		o[name] = string(b)
+	}
+	return o
+}
+
+func sameFiles(a, b map[string]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for k, v := range a {
+		if w, ok := b[k]; !ok || v != w {
+			return false
+		}
+	}
+	return true
+}
+
+func TestRollback(t *testing.T) {
+	dir, clean := asteriskTestDir(t)
+	defer clean()
+
+	var states []map[string]string
+	for _, v := range []string{
+		`{"airtel1": {"imei": "353220047976425", "calls_out": "own"}}`,
+		`{"airtel1": {"imei": "353220047976425", "calls_out": "own", "rx-gain": 3}}`,
+		`{"tigo1": {"imei": "352215045819420", "calls_out": "any"}}`,
+	} {
+		states = append(states, readFiles(t, dir))
+		c, err := DecodeConfig([]byte(v))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = writeDongles(c); err != nil {
+			t.Fatal(err)
+		}
+	}
+	trunks, err := DecodeSipConfig([]byte(sipConfig))
+	if err != nil {
+		t.Fatal(err)
+	}
+	states = append(states, readFiles(t, dir))
+	if err = writeSip(trunks); err != nil {
+		t.Fatal(err)
+	}
+	for i := len(states) - 1; i >= 0; i-- {
+		if _, err = rollback(dir); err != nil {
+			t.Fatal(err)
+		}
+		if got := readFiles(t, dir); !sameFiles(got, states[i]) {
+			t.Errorf("%d: expected the files to be restored got %v", i, got)
+		}
+	}
+	if _, err = rollback(dir); err == nil {
+		t.Error("expected an error when there is no backup left")
+	}
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, v := range infos {
+		if v.Name() != diaplanTpl && v.Name() != backupDir {
+			t.Errorf("unexpected file %s", v.Name())
+		}
+	}
+}
+
+func TestCommitUnchanged(t *testing.T) {
+	dir, clean := asteriskTestDir(t)
+	defer clean()
+
+	c, err := DecodeConfig([]byte(`{"airtel1": {"imei": "353220047976425", "calls_out": "own"}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		if err = writeDongles(c); err != nil {
+			t.Fatal(err)
+		}
+	}
+	names, err := backups(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(names) != 1 {
+		t.Errorf("expected only the first run to be backed up got %v", names)
+	}
+}
+
+func TestWriteDonglesTemplateError(t *testing.T) {
+	dir, clean := asteriskTestDir(t)
+	defer clean()
+
+	c, err := DecodeConfig([]byte(`{"airtel1": {"imei": "353220047976425", "calls_out": "own"}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = writeDongles(c); err != nil {
+		t.Fatal(err)
+	}
+	before := readFiles(t, dir)
+	err = ioutil.WriteFile(filepath.Join(dir, diaplanTpl), []byte("{{range .Dongles}}"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c, err = DecodeConfig([]byte(`{"tigo1": {"imei": "352215045819420", "calls_out": "own"}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = writeDongles(c); err == nil {
+		t.Fatal("expected the broken template to fail")
+	}
+	if got := readFiles(t, dir); !sameFiles(got, before) {
+		t.Errorf("expected the files to be left as they were got %v", got)
+	}
+	names, err := backups(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(names) != 1 {
+		t.Errorf("expected 1 backup got %d", len(names))
+	}
+}
+
+func TestPruneBackups(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fastc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	now := time.Date(2016, 10, 17, 8, 0, 0, 0, time.UTC)
+	for i := 0; i < maxBackups+3; i++ {
+		if _, err = makeBackup(dir, now.Add(time.Duration(i)*time.Minute)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = pruneBackups(dir); err != nil {
+		t.Fatal(err)
+	}
+	names, err := backups(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(names) != maxBackups {
+		t.Fatalf("expected %d backups got %d", maxBackups, len(names))
+	}
+	if first := now.Add(3 * time.Minute).Format(backupTime); names[0] != first {
+		t.Errorf("expected the oldest backup to be %s got %s", first, names[0])
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+
+	"github.com/FarmRadioHangar/fastc/asteriskconf"
+	"github.com/urfave/cli"
+)
+
+// formatOptions returns the options of asteriskconf.Format set by the flags of
+// the fmt command.
+func formatOptions(ctx *cli.Context) asteriskconf.FormatOptions {
+	return asteriskconf.FormatOptions{
+		Spaces:        ctx.Bool("spaces"),
+		AlignComments: ctx.Bool("align"),
+		SectionLines:  ctx.Bool("sections"),
+	}
+}
+
+// formatFile returns the content of the configuration file at path and the
+// same content in the canonical format of opts.
+func formatFile(path string, opts asteriskconf.FormatOptions) (src, formatted []byte, err error) {
+	src, err = ioutil.ReadFile(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	a, err := asteriskconf.ParseFile(filepath.Dir(path), filepath.Base(path), asteriskconf.IncludeNone)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s: %v", path, err)
+	}
+	var buf bytes.Buffer
+	if err = asteriskconf.Format(&buf, a, opts); err != nil {
+		return nil, nil, err
+	}
+	return src, buf.Bytes(), nil
+}
+
+// Fmt formats asterisk configuration files. The formatted files are printed,
+// unless they are listed with -l, diffed with -d or written in place with -w.
+// With -l and -d the command exits with 1 if any file is not formatted.
+func Fmt(ctx *cli.Context) error {
+	if len(ctx.Args()) == 0 {
+		return errors.New("supply the config files to format")
+	}
+	opts := formatOptions(ctx)
+	w := ctx.App.Writer
+	changed := false
+	for _, path := range ctx.Args() {
+		src, formatted, err := formatFile(path, opts)
+		if err != nil {
+			return err
+		}
+		same := bytes.Equal(src, formatted)
+		changed = changed || !same
+		switch {
+		case ctx.Bool("l"):
+			if !same {
+				fmt.Fprintln(w, path)
+			}
+		case ctx.Bool("d"):
+			if err = unifiedDiff(w, path, path, src, formatted); err != nil {
+				return err
+			}
+		case ctx.Bool("w"):
+			if !same {
+				files, err := replaceFile(path, func(string) ([]byte, error) {
+					return formatted, nil
+				})
+				if err != nil {
+					return err
+				}
+				if err = files.commit(); err != nil {
+					return err
+				}
+			}
+		default:
+			if _, err = w.Write(formatted); err != nil {
+				return err
+			}
+		}
+	}
+	if changed && (ctx.Bool("l") || ctx.Bool("d")) {
+		return cli.NewExitError("", 1)
+	}
+	return nil
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/urfave/cli"
+)
+
+func TestFmt(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fastc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	messy := filepath.Join(dir, "messy.conf")
+	clean := filepath.Join(dir, "clean.conf")
+	src := "[general]   \ninterval=15 ; seconds\n\n\n[airtel1]\nimei=353220047976425\n"
+	expect := "[general]\ninterval = 15 ; seconds\n\n[airtel1]\nimei = 353220047976425\n"
+	if err = ioutil.WriteFile(messy, []byte(src), 0640); err != nil {
+		t.Fatal(err)
+	}
+	if err = ioutil.WriteFile(clean, []byte(expect), 0644); err != nil {
+		t.Fatal(err)
+	}
+	run := func(args ...string) (string, error) {
+		var buf bytes.Buffer
+		app := newApp()
+		app.Writer = &buf
+		app.ExitErrHandler = func(*cli.Context, error) {}
+		err := app.Run(append([]string{"fastc", "fmt", "-s"}, args...))
+		return buf.String(), err
+	}
+
+	out, err := run(messy)
+	if err != nil || out != expect {
+		t.Errorf("expected\n%s\ngot %v\n%s", expect, err, out)
+	}
+	out, err = run("-l", messy, clean)
+	if e, ok := err.(cli.ExitCoder); !ok || e.ExitCode() != 1 {
+		t.Errorf("expected exit status 1 got %v", err)
+	}
+	if out != messy+"\n" {
+		t.Errorf("expected only %s to be listed got %q", messy, out)
+	}
+	out, _ = run("-d", messy)
+	if !bytes.Contains([]byte(out), []byte("-interval=15 ; seconds\n+[general]\n+interval = 15 ; seconds\n")) {
+		t.Errorf("expected the change in the diff got\n%s", out)
+	}
+	if _, err = run("-w", messy, clean); err != nil {
+		t.Fatal(err)
+	}
+	b, err := ioutil.ReadFile(messy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != expect {
+		t.Errorf("expected the file to be formatted got\n%s", b)
+	}
+	info, err := os.Stat(messy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0640 {
+		t.Errorf("expected the permissions to be kept got %v", info.Mode())
+	}
+	if _, err = os.Stat(filepath.Join(dir, backupDir)); !os.IsNotExist(err) {
+		t.Errorf("expected no backup to be made got %v", err)
+	}
+	if out, err = run("-l", messy, clean); err != nil || out != "" {
+		t.Errorf("expected no file to be listed got %v %q", err, out)
+	}
+	if _, err = run(filepath.Join(dir, "missing.conf")); err == nil {
+		t.Error("expected an error for a missing file")
+	}
+}
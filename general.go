@@ -0,0 +1,117 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// General is the [general] section of the chan_dongle configuration, with the
+// interval between the attempts to connect to the devices and the jitter
+// buffer options.
+//
+// Nil pointers and empty strings are options that are not set, chan_dongle
+// uses its defaults for them.
+type General struct {
+	Interval          *int
+	JBEnable          *bool
+	JBForce           *bool
+	JBMaxSize         *int
+	JBResyncThreshold *int
+	JBImpl            string
+	JBTargetExtra     *int
+	JBLog             *bool
+}
+
+// generalOption maps a field of the general json object to the chan_dongle
+// option it sets.
+type generalOption struct {
+	json  string
+	conf  string
+	field func(g *General) interface{}
+}
+
+// generalOptions are the fields of the general json object, in the order they
+// are documented in modem.conf.
+var generalOptions = []generalOption{
+	{"interval", "interval", func(g *General) interface{} { return &g.Interval }},
+	{"jb-enable", "jbenable", func(g *General) interface{} { return &g.JBEnable }},
+	{"jb-force", "jbforce", func(g *General) interface{} { return &g.JBForce }},
+	{"jb-max-size", "jbmaxsize", func(g *General) interface{} { return &g.JBMaxSize }},
+	{"jb-resync-threshold", "jbresyncthreshold", func(g *General) interface{} { return &g.JBResyncThreshold }},
+	{"jb-impl", "jbimpl", func(g *General) interface{} { return &g.JBImpl }},
+	{"jb-target-extra", "jbtargetextra", func(g *General) interface{} { return &g.JBTargetExtra }},
+	{"jb-log", "jblog", func(g *General) interface{} { return &g.JBLog }},
+}
+
+// jbImpls are the jitter buffer implementations of asterisk.
+var jbImpls = []string{"fixed", "adaptive"}
+
+// decode sets the fields of g from the fields of the general json object.
+func (g *General) decode(obj map[string]json.RawMessage) error {
+	fields := make(map[string]interface{})
+	for _, v := range generalOptions {
+		fields[v.json] = v.field(g)
+	}
+	if errs := decodeFields(generalSection, obj, fields); len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// Validate checks the options of g, all the invalid options are returned as a
+// FieldErrors.
+//
+// The jitter buffer options other than jb-enable need the jitter buffer to be
+// enabled, jb-impl must be fixed or adaptive, and jb-target-extra is only
+// accepted with the adaptive implementation.
+func (g *General) Validate() error {
+	var errs FieldErrors
+	add := func(field, msg string) {
+		errs = append(errs, &FieldError{Dongle: generalSection, Field: field, Msg: msg})
+	}
+	for _, v := range []struct {
+		field    string
+		value    *int
+		min, max int
+	}{
+		{"interval", g.Interval, 1, 3600},
+		{"jb-max-size", g.JBMaxSize, 1, 10000},
+		{"jb-resync-threshold", g.JBResyncThreshold, -1, 100000},
+		{"jb-target-extra", g.JBTargetExtra, 0, 10000},
+	} {
+		if v.value != nil && (*v.value < v.min || *v.value > v.max) {
+			add(v.field, fmt.Sprintf("must be between %d and %d", v.min, v.max))
+		}
+	}
+	if g.JBImpl != "" && !oneOf(g.JBImpl, jbImpls) {
+		add("jb-impl", "must be fixed or adaptive")
+	}
+	if g.JBTargetExtra != nil && g.JBImpl != "adaptive" {
+		add("jb-target-extra", "is only used when jb-impl is adaptive")
+	}
+	if g.JBEnable == nil || !*g.JBEnable {
+
+		// the options after interval and jb-enable
+		for _, opt := range generalOptions[2:] {
+			if _, ok := confValue(opt.field(g)); ok {
+				add(opt.json, "needs jb-enable to be true")
+			}
+		}
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// Options returns the chan_dongle options set in g, as their names and values
+// in the dongle configuration file, in the order of generalOptions.
+func (g *General) Options() [][2]string {
+	var o [][2]string
+	for _, opt := range generalOptions {
+		if v, ok := confValue(opt.field(g)); ok {
+			o = append(o, [2]string{opt.conf, v})
+		}
+	}
+	return o
+}
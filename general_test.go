@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/FarmRadioHangar/fastc/asteriskconf"
+)
+
+func TestDecodeGeneral(t *testing.T) {
+	src := `{
+	"general": {
+		"interval": 15,
+		"jb-enable": true,
+		"jb-max-size": 200,
+		"jb-impl": "adaptive",
+		"jb-target-extra": 40
+	},
+	"defaults": {
+		"context": "from-trunk",
+		"rx-gain": 2,
+		"disable-sms": false
+	},
+	"airtel1": {
+		"imei": "353220047976425"
+	}
+}`
+	c, err := DecodeConfig([]byte(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	asteriskconf.PrintAst(&buf, ToAST(c))
+	p, err := asteriskconf.NewParser(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, err := p.Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, v := range a.Sections[1:] {
+		names = append(names, v.Name())
+	}
+	if len(names) != 3 || names[0] != "general" || names[1] != "defaults" || names[2] != "airtel1" {
+		t.Errorf("expected general, defaults and airtel1 got %v", names)
+	}
+	expect := map[string]map[string]string{
+		"general": {
+			"interval":      "15",
+			"jbenable":      "yes",
+			"jbmaxsize":     "200",
+			"jbimpl":        "adaptive",
+			"jbtargetextra": "40",
+		},
+		"defaults": {
+			"context":    "from-trunk",
+			"rxgain":     "2",
+			"disablesms": "no",
+		},
+	}
+	for name, keys := range expect {
+		s, err := a.Section(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for k, v := range keys {
+			got, err := s.Get(k)
+			if err != nil || got != v {
+				t.Errorf("expected %s %s=%s got %s", name, k, v, got)
+			}
+		}
+	}
+}
+
+func TestDecodeGeneralErrors(t *testing.T) {
+	src := `{
+	"general": {
+		"interval": 0,
+		"jb-max-size": 200,
+		"jb-impl": "dynamic",
+		"jb-target-extra": 40
+	},
+	"defaults": {
+		"imei": "353220047976425",
+		"dtmf": "loud"
+	}
+}`
+	_, err := DecodeConfig([]byte(src))
+	errs, ok := err.(FieldErrors)
+	if !ok {
+		t.Fatalf("expected FieldErrors got %v", err)
+	}
+	expect := []struct {
+		section, field string
+	}{
+		{"defaults", "imei"},
+		{"defaults", "dtmf"},
+		{"general", "interval"},
+		{"general", "jb-impl"},
+		{"general", "jb-target-extra"},
+		{"general", "jb-max-size"},
+		{"general", "jb-impl"},
+		{"general", "jb-target-extra"},
+	}
+	if len(errs) != len(expect) {
+		t.Fatalf("expected %d errors got %d: %v", len(expect), len(errs), errs)
+	}
+	for i, v := range expect {
+		if errs[i].Dongle != v.section || errs[i].Field != v.field {
+			t.Errorf("expected %s %s got %s", v.section, v.field, errs[i])
+		}
+	}
+	if msg := errs[0].Error(); msg != "defaults: imei is not a known field" {
+		t.Errorf("unexpected message %s", msg)
+	}
+}
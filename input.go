@@ -0,0 +1,276 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/FarmRadioHangar/fastc/asteriskconf"
+	"github.com/urfave/cli"
+)
+
+// inputTimeout is how long fastc waits for the configuration served at a url.
+const inputTimeout = 10 * time.Second
+
+// errNoInput is returned when a command is given no configuration.
+var errNoInput = errors.New("supply a config file, a url on localhost, env:NAME or - to read stdin")
+
+// readInput returns the configuration given to a command by its first
+// argument, see readSource.
+func readInput(ctx *cli.Context) ([]byte, error) {
+	return readSource(ctx.Args().First(), os.Stdin)
+}
+
+// readSource reads the configuration from src, which is one of
+//
+//	stdin or -       the whole stream read from stdin
+//	env:NAME         the value of the environment variable NAME
+//	http://host/...  the body served at the url, host must be the local host
+//	anything else    the content of the file src
+func readSource(src string, stdin io.Reader) ([]byte, error) {
+	switch {
+	case src == "":
+		return nil, errNoInput
+	case src == "-" || src == "stdin":
+		return ioutil.ReadAll(stdin)
+	case strings.HasPrefix(src, "env:"):
+		v, ok := os.LookupEnv(src[len("env:"):])
+		if !ok {
+			return nil, fmt.Errorf("environment variable %s is not set", src[len("env:"):])
+		}
+		return []byte(v), nil
+	case strings.HasPrefix(src, "http://") || strings.HasPrefix(src, "https://"):
+		return readURL(src)
+	}
+	return ioutil.ReadFile(src)
+}
+
+// readURL returns the body served at the url src. Only urls on the local host
+// are accepted, fastc is not meant to fetch its configuration over the network.
+// Redirects are followed only when they stay on the local host.
+func readURL(src string) ([]byte, error) {
+	u, err := url.Parse(src)
+	if err != nil {
+		return nil, err
+	}
+	if !isLocalHost(u.Hostname()) {
+		return nil, fmt.Errorf("%s is not on the local host", src)
+	}
+	client := &http.Client{
+		Timeout: inputTimeout,
+		CheckRedirect: func(r *http.Request, via []*http.Request) error {
+			if !isLocalHost(r.URL.Hostname()) {
+				return fmt.Errorf("redirected to %s, which is not on the local host", r.URL)
+			}
+			if len(via) >= 10 {
+				return errors.New("stopped after 10 redirects")
+			}
+			return nil
+		},
+	}
+	res, err := client.Get(src)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s: %s", src, res.Status)
+	}
+	return ioutil.ReadAll(res.Body)
+}
+
+// isLocalHost returns true if host is localhost or a loopback address.
+func isLocalHost(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// isJSON returns true if src is a json document rather than an asterisk
+// configuration file. Invalid input that starts like a json object is taken as
+// json, so that its syntax error is reported.
+func isJSON(src []byte) bool {
+	src = bytes.TrimSpace(trimBOM(src))
+	return json.Valid(src) || bytes.HasPrefix(src, []byte("{"))
+}
+
+// trimBOM removes the utf-8 byte order mark some editors write at the start of
+// a file.
+func trimBOM(src []byte) []byte {
+	return bytes.TrimPrefix(src, []byte("\xef\xbb\xbf"))
+}
+
+// decodeDongleInput decodes the input of the dongles command. It is either the
+// json object decoded by DecodeConfig, or a chan_dongle configuration file
+// whose options are turned into their json fields first. A configuration file
+// has no dialplan fields, they are kept from the trunk state so that the
+// dongles stay in the outbound routes.
+func decodeDongleInput(src []byte) (*Config, error) {
+	src = trimBOM(src)
+	if !isJSON(src) {
+		p, err := asteriskconf.NewParser(bytes.NewReader(src))
+		if err != nil {
+			return nil, err
+		}
+		a, err := p.Parse()
+		if err != nil {
+			return nil, err
+		}
+		trunks, err := loadTrunks(asteriskDir())
+		if err != nil {
+			return nil, err
+		}
+		src, err = dongleConfJSON(a, trunks.Dongles)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return DecodeConfig(src)
+}
+
+// dongleConfJSON returns the json object of the chan_dongle configuration a. The
+// options are renamed to their json fields and their values converted to the
+// json types of the fields. The options fastc does not know, and the values
+// that can not be converted, are kept as they are for DecodeConfig to report
+// them. The fields only used in the dialplan are taken from dongles, see
+// addDialPlanFields.
+//
+// The templates are not configured themselves, the sections inheriting from
+// them get their options.
+func dongleConfJSON(a *asteriskconf.Ast, dongles []map[string]interface{}) ([]byte, error) {
+	o, err := dongleConfObjects(a, true)
+	if err != nil {
+		return nil, err
+	}
+	addDialPlanFields(o, dongles)
+	return json.Marshal(o)
+}
+
+// addDialPlanFields sets the fields of the dongle objects of o that are only
+// used in the dialplan, like calls_out, from dongles, the dialplan template data
+// of the trunk state. The objects that already have one of them are left as
+// they are.
+func addDialPlanFields(o map[string]map[string]interface{}, dongles []map[string]interface{}) {
+	for _, d := range dongles {
+		name, _ := d["name"].(string)
+		obj, ok := o[name]
+		if !ok || name == generalSection || hasDialPlanFields(obj) {
+			continue
+		}
+		for _, opt := range dongleOptions {
+			if opt.conf != "" || opt.field == nil {
+				continue
+			}
+			if v, ok := d[opt.json]; ok && v != "" {
+				obj[opt.json] = v
+			}
+		}
+	}
+}
+
+// hasDialPlanFields returns true if obj has a field only used in the dialplan.
+func hasDialPlanFields(obj map[string]interface{}) bool {
+	for _, opt := range dongleOptions {
+		if opt.conf != "" || opt.field == nil {
+			continue
+		}
+		if _, ok := obj[opt.json]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// dongleConfObjects returns the json objects of the sections of a, keyed by the
+// section names, see dongleConfJSON. When resolve is false the templates are
+// kept, and the sections only have the options they define themselves.
+func dongleConfObjects(a *asteriskconf.Ast, resolve bool) (map[string]map[string]interface{}, error) {
+	o := make(map[string]map[string]interface{})
+	for _, s := range a.Sections {
+		if s.Appends() || (s.Name() == "main" && len(s.Values()) == 0) {
+			continue
+		}
+		r := s
+		if resolve {
+			if s.IsTemplate() {
+				continue
+			}
+			var err error
+			if r, err = a.Resolve(s.Name()); err != nil {
+				return nil, err
+			}
+		}
+		if s.Name() == generalSection {
+			g := &General{}
+			o[s.Name()] = confFields(r, func(key string) (string, interface{}) {
+				for _, v := range generalOptions {
+					if v.conf == key {
+						return v.json, v.field(g)
+					}
+				}
+				return key, nil
+			})
+			continue
+		}
+		d := &Dongle{}
+		o[s.Name()] = confFields(r, func(key string) (string, interface{}) {
+			for _, v := range dongleOptions {
+				if v.conf == key && v.conf != "" {
+					return v.json, v.field(d)
+				}
+			}
+			return key, nil
+		})
+	}
+	return o, nil
+}
+
+// confFields returns the options of s keyed by their json names. field returns
+// the json name of an option and a pointer to the field it sets, which gives
+// the type its value is converted to.
+func confFields(s *asteriskconf.NodeSection, field func(key string) (string, interface{})) map[string]interface{} {
+	o := make(map[string]interface{})
+	for _, v := range s.Values() {
+		name, f := field(v.Key())
+		value := v.Value()
+		switch f.(type) {
+		case **int:
+			if n, err := strconv.Atoi(value); err == nil {
+				o[name] = n
+				continue
+			}
+		case **bool:
+			if b, ok := confBool(value); ok {
+				o[name] = b
+				continue
+			}
+		}
+		o[name] = value
+	}
+	return o
+}
+
+// confBool returns the boolean value of v, and false if v is not one of the
+// boolean values of asterisk configuration files.
+func confBool(v string) (value, ok bool) {
+	if isTrue(v) {
+		return true, true
+	}
+	switch strings.ToLower(v) {
+	case "no", "false", "n", "f", "0", "off":
+		return false, true
+	}
+	return false, false
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// prettyConfig is a pretty printed json config, which used to be cut after its
+// first line when read from stdin.
+const prettyConfig = `{
+	"general": {
+		"interval": 15
+	},
+	"airtel1": {
+		"imei": "353220047976425",
+		"rx-gain": 3,
+		"disable": false,
+		"calls_out": "own"
+	}
+}
+`
+
+func TestReadSource(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fastc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "dongles.json")
+	if err = ioutil.WriteFile(file, []byte(prettyConfig), 0644); err != nil {
+		t.Fatal(err)
+	}
+	os.Setenv("FASTC_TEST_CONFIG", prettyConfig)
+	defer os.Unsetenv("FASTC_TEST_CONFIG")
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/dongles":
+		case "/moved":
+			http.Redirect(w, r, "/dongles", http.StatusFound)
+			return
+		case "/elsewhere":
+			http.Redirect(w, r, "http://example.com/dongles.json", http.StatusFound)
+			return
+		default:
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprint(w, prettyConfig)
+	}))
+	defer ts.Close()
+	local := strings.Replace(ts.URL, "127.0.0.1", "localhost", 1)
+
+	for _, src := range []string{"-", "stdin", file, "env:FASTC_TEST_CONFIG", ts.URL + "/dongles", local + "/dongles", ts.URL + "/moved"} {
+		b, err := readSource(src, strings.NewReader(prettyConfig))
+		if err != nil {
+			t.Errorf("%s: %v", src, err)
+			continue
+		}
+		if string(b) != prettyConfig {
+			t.Errorf("%s: expected the whole config got %q", src, b)
+		}
+	}
+	for _, src := range []string{
+		"",
+		"env:FASTC_TEST_UNSET",
+		ts.URL + "/missing",
+		ts.URL + "/elsewhere",
+		"http://example.com/dongles.json",
+		filepath.Join(dir, "missing.json"),
+	} {
+		if _, err := readSource(src, strings.NewReader("")); err == nil {
+			t.Errorf("%q: expected an error", src)
+		}
+	}
+}
+
+func TestDecodeDongleInput(t *testing.T) {
+	_, clean := asteriskTestDir(t)
+	defer clean()
+
+	conf := `; an existing chan_dongle configuration
+[general]
+interval=15
+
+[common](!)
+rxgain=3
+disable=no
+
+[airtel1](common)
+imei=353220047976425
+`
+	fromConf, err := decodeDongleInput([]byte(conf))
+	if err != nil {
+		t.Fatal(err)
+	}
+	fromJSON, err := decodeDongleInput([]byte("\xef\xbb\xbf" + prettyConfig))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// calls_out is only used by the dialplan, it has no chan_dongle option
+	fromJSON.Dongles[0].CallsOut = ""
+	if !reflect.DeepEqual(fromConf, fromJSON) {
+		t.Errorf("expected the same config from the conf and the json input")
+	}
+
+	appended, err := decodeDongleInput([]byte(conf + "\n[airtel1](+)\ntxgain=2\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(appended.Dongles) != 1 || appended.Dongles[0].TxGain == nil || *appended.Dongles[0].TxGain != 2 {
+		t.Errorf("expected the appended section to be merged into airtel1")
+	}
+
+	_, err = decodeDongleInput([]byte("[airtel1]\nimei=353220047976425\nrxgain=loud\ncolor=red\n"))
+	errs, ok := err.(FieldErrors)
+	if !ok || len(errs) != 2 {
+		t.Fatalf("expected 2 field errors got %v", err)
+	}
+	for i, v := range []string{
+		"dongle airtel1: color is not a known field",
+		"dongle airtel1: rx-gain must be an integer",
+	} {
+		if errs[i].Error() != v {
+			t.Errorf("expected %q got %q", v, errs[i].Error())
+		}
+	}
+	if _, err = decodeDongleInput([]byte(`{"airtel1": {`)); err == nil || !strings.Contains(err.Error(), "JSON") {
+		t.Errorf("expected a json syntax error got %v", err)
+	}
+}
+
+// TestDecodeDongleConfState checks that the dongles configured with a
+// chan_dongle configuration file keep their dialplan fields.
+func TestDecodeDongleConfState(t *testing.T) {
+	dir, clean := asteriskTestDir(t)
+	defer clean()
+
+	c, err := DecodeConfig([]byte(prettyConfig))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = writeDongles(c); err != nil {
+		t.Fatal(err)
+	}
+	conf, err := ioutil.ReadFile(filepath.Join(dir, dongleFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	fromConf, err := decodeDongleInput(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(fromConf, c) {
+		t.Errorf("expected the config to be kept got %+v", fromConf.Dongles[0])
+	}
+	files, err := dongleFiles(fromConf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if _, err = files.diff(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if buf.Len() != 0 {
+		t.Errorf("expected no change got\n%s", buf.String())
+	}
+}
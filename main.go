@@ -8,20 +8,121 @@ import (
 )
 
 func main() {
+	err := newApp().Run(os.Args)
+	if err != nil {
+		log.Fatalf("fconf: %v", err)
+	}
+}
+
+// inputUsage is the usage of the configuration argument of the commands.
+const inputUsage = "FILE | - | env:NAME | http://localhost/PATH"
+
+// newApp returns the fastc command line application.
+func newApp() *cli.App {
 	app := cli.NewApp()
 	app.Version = "0.1.5"
 	app.Name = "fastc"
 	app.Usage = "configures asterisk using json"
+	dryRun := cli.BoolFlag{
+		Name:  "dry-run, diff",
+		Usage: "print the changes as unified diffs instead of writing them, exits with 1 if there are any",
+	}
+	reload := []cli.Flag{
+		cli.BoolFlag{
+			Name:  "reload",
+			Usage: "reload asterisk through the manager interface after writing the files",
+		},
+		cli.StringFlag{
+			Name:  "ami-user",
+			Usage: "the manager.conf user to reload asterisk with, the first one allowed to by default",
+		},
+	}
 	app.Commands = []cli.Command{
 		{
-			Name:    "dongles",
-			Aliases: []string{"d"},
-			Usage:   "configures asterisk dongles with json",
-			Action:  Dongles,
+			Name:      "dongles",
+			Aliases:   []string{"d"},
+			Usage:     "configures asterisk dongles with json or a chan_dongle config",
+			ArgsUsage: inputUsage,
+			Action:    Dongles,
+			Flags:     append([]cli.Flag{dryRun}, reload...),
+		},
+		{
+			Name:      "sip",
+			Aliases:   []string{"s"},
+			Usage:     "configures asterisk sip and pjsip trunks with json",
+			ArgsUsage: inputUsage,
+			Action:    Sip,
+			Flags:     append([]cli.Flag{dryRun}, reload...),
+		},
+		{
+			Name:   "serve",
+			Usage:  "serves the dongle configuration over http",
+			Action: Serve,
+			Flags: append([]cli.Flag{
+				cli.StringFlag{
+					Name:  "addr",
+					Value: "127.0.0.1:8090",
+					Usage: "the address to listen on",
+				},
+			}, reload...),
+		},
+		{
+			Name:      "get",
+			Usage:     "prints the values of a key of an asterisk config file",
+			ArgsUsage: "FILE SECTION.KEY[INDEX]",
+			Action:    Get,
+		},
+		{
+			Name:      "set",
+			Usage:     "sets the value of a key of an asterisk config file in place",
+			ArgsUsage: "FILE SECTION.KEY[INDEX] VALUE",
+			Action:    Set,
+			Flags:     []cli.Flag{dryRun},
+		},
+		{
+			Name:      "unset",
+			Usage:     "removes a key of an asterisk config file in place",
+			ArgsUsage: "FILE SECTION.KEY[INDEX]",
+			Action:    Unset,
+			Flags:     []cli.Flag{dryRun},
+		},
+		{
+			Name:      "fmt",
+			Usage:     "formats asterisk config files",
+			ArgsUsage: "FILE...",
+			Action:    Fmt,
+			Flags: []cli.Flag{
+				cli.BoolFlag{
+					Name:  "l",
+					Usage: "list the files that are not formatted, exits with 1 if there are any",
+				},
+				cli.BoolFlag{
+					Name:  "d",
+					Usage: "print the changes as unified diffs, exits with 1 if there are any",
+				},
+				cli.BoolFlag{
+					Name:  "w",
+					Usage: "write the formatted files in place instead of printing them",
+				},
+				cli.BoolFlag{
+					Name:  "spaces, s",
+					Usage: "write definitions as key = value instead of key=value",
+				},
+				cli.BoolFlag{
+					Name:  "align",
+					Usage: "align the trailing comments of consecutive lines in a column",
+				},
+				cli.BoolFlag{
+					Name:  "sections",
+					Usage: "put exactly one blank line before each section",
+				},
+			},
+		},
+		{
+			Name:   "rollback",
+			Usage:  "restores the files written by fastc before its last run",
+			Action: Rollback,
 		},
 	}
-	err := app.Run(os.Args)
-	if err != nil {
-		log.Fatalf("fconf: %v", err)
-	}
+	return app
 }
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"sync"
+
+	"github.com/urfave/cli"
+)
+
+// maxRequestSize is the largest request body accepted by the http api.
+const maxRequestSize = 1 << 20
+
+// server is the http api of fastc. The requests changing the configuration are
+// handled one at a time, and the reads wait for them.
+type server struct {
+	mu sync.RWMutex
+
+	// reload is the manager interface used to reload asterisk after the
+	// configuration is changed, nil if asterisk is not reloaded.
+	reload *amiConfig
+}
+
+// apiError is the json body of the error responses. Fields holds the invalid
+// fields of the configuration, if that is what went wrong.
+type apiError struct {
+	Error  string     `json:"error"`
+	Fields []apiField `json:"fields,omitempty"`
+}
+
+// apiField is an invalid field of the configuration.
+type apiField struct {
+	Dongle  string `json:"dongle"`
+	Field   string `json:"field,omitempty"`
+	Message string `json:"message"`
+}
+
+// Serve runs the http api until it fails.
+//
+//	GET  /dongles           the dongle configuration file as json
+//	PUT  /dongles           configures the dongles like the dongles command
+//	POST /dongles/validate  checks a configuration without applying it
+func Serve(ctx *cli.Context) error {
+	s := &server{}
+	if ctx.Bool("reload") {
+		c, err := readManagerConf(asteriskDir(), ctx.String("ami-user"))
+		if err != nil {
+			return err
+		}
+		s.reload = c
+	}
+	addr := ctx.String("addr")
+	log.Printf("fastc: serving on %s", addr)
+	return http.ListenAndServe(addr, s.handler())
+}
+
+func (s *server) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/dongles", s.dongles)
+	mux.HandleFunc("/dongles/validate", s.validate)
+	return mux
+}
+
+func (s *server) dongles(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		s.mu.RLock()
+		defer s.mu.RUnlock()
+		s.writeDongles(w)
+	case http.MethodPut:
+		s.putDongles(w, r)
+	default:
+		w.Header().Set("Allow", "GET, PUT")
+		writeError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+	}
+}
+
+// putDongles applies the configuration in the body of r, and responds with the
+// new content of the dongle configuration file.
+func (s *server) putDongles(w http.ResponseWriter, r *http.Request) {
+	c, err := decodeRequest(w, r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	files, err := dongleFiles(c)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if err = files.commit(); err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	if s.reload != nil {
+		var out bytes.Buffer
+		if err = reloadAsterisk(&out, s.reload, dongleReload); err != nil {
+			writeError(w, http.StatusBadGateway, err)
+			return
+		}
+		log.Print(out.String())
+	}
+	s.writeDongles(w)
+}
+
+func (s *server) validate(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		writeError(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+		return
+	}
+	if _, err := decodeRequest(w, r); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]bool{"valid": true})
+}
+
+// writeDongles writes the dongle configuration file as the json accepted by
+// PUT, or an empty object if there is none yet. The fields that are only used
+// in the dialplan, like calls_out, are taken from the trunk state.
+func (s *server) writeDongles(w http.ResponseWriter) {
+	a, err := readDongles()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	o, err := dongleConfObjects(a, false)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	trunks, err := loadTrunks(asteriskDir())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	addDialPlanFields(o, trunks.Dongles)
+	writeJSON(w, http.StatusOK, o)
+}
+
+// decodeRequest decodes and validates the configuration in the body of r.
+func decodeRequest(w http.ResponseWriter, r *http.Request) (*Config, error) {
+	b, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxRequestSize))
+	if err != nil {
+		return nil, err
+	}
+	return decodeDongleInput(b)
+}
+
+// writeError writes err as an apiError. Invalid fields are reported with the
+// status 422, and imei collisions with 409.
+func writeError(w http.ResponseWriter, status int, err error) {
+	e := &apiError{Error: err.Error()}
+	switch v := err.(type) {
+	case FieldErrors:
+		status = http.StatusUnprocessableEntity
+		e.Error = "invalid configuration"
+		for _, f := range v {
+			e.Fields = append(e.Fields, apiField{Dongle: f.Dongle, Field: f.Field, Message: f.Msg})
+		}
+	case IMEICollisions:
+		status = http.StatusConflict
+	}
+	writeJSON(w, status, e)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
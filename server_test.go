@@ -0,0 +1,104 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestServer(t *testing.T) {
+	_, clean := asteriskTestDir(t)
+	defer clean()
+	ts := httptest.NewServer((&server{}).handler())
+	defer ts.Close()
+
+	// do is also called from the goroutines of the concurrent writes, so it
+	// reports its errors with t.Error.
+	do := func(method, path, body string) (int, string) {
+		req, err := http.NewRequest(method, ts.URL+path, strings.NewReader(body))
+		if err != nil {
+			t.Error(err)
+			return 0, ""
+		}
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Error(err)
+			return 0, ""
+		}
+		defer res.Body.Close()
+		b, err := ioutil.ReadAll(res.Body)
+		if err != nil {
+			t.Error(err)
+			return 0, ""
+		}
+		if ct := res.Header.Get("Content-Type"); ct != "application/json" {
+			t.Errorf("%s %s: expected json got %s", method, path, ct)
+		}
+		return res.StatusCode, string(b)
+	}
+	valid := `{"airtel1": {"imei": "353220047976425", "calls_out": "own", "rx-gain": 3}}`
+	invalid := `{"airtel1": {"imei": "3532200", "rx-gain": 30}}`
+	sample := []struct {
+		method, path, body string
+		status             int
+		expect             string
+	}{
+		{"GET", "/dongles", "", 200, "{}\n"},
+		{"POST", "/dongles/validate", valid, 200, `{"valid":true}` + "\n"},
+		{"POST", "/dongles/validate", invalid, 422, `{"error":"invalid configuration","fields":[{"dongle":"airtel1","field":"imei","message":"must be exactly 15 digits"},{"dongle":"airtel1","field":"rx-gain","message":"must be between -20 and 20"}]}` + "\n"},
+		{"POST", "/dongles/validate", "{", 400, `{"error":"unexpected end of JSON input"}` + "\n"},
+		{"GET", "/dongles", "", 200, "{}\n"},
+		{"PUT", "/dongles", invalid, 422, ""},
+		{"PUT", "/dongles", valid, 200, `{"airtel1":{"calls_out":"own","imei":"353220047976425","rx-gain":3}}` + "\n"},
+		{"GET", "/dongles", "", 200, `{"airtel1":{"calls_out":"own","imei":"353220047976425","rx-gain":3}}` + "\n"},
+		{"DELETE", "/dongles", "", 405, `{"error":"method not allowed"}` + "\n"},
+		{"GET", "/dongles/validate", "", 405, `{"error":"method not allowed"}` + "\n"},
+	}
+	for i, v := range sample {
+		status, body := do(v.method, v.path, v.body)
+		if status != v.status {
+			t.Errorf("%d: expected status %d got %d %s", i, v.status, status, body)
+		}
+		if v.expect != "" && body != v.expect {
+			t.Errorf("%d: expected %s got %s", i, v.expect, body)
+		}
+	}
+
+	// concurrent writes are applied one after the other, each of them
+	// leaving a complete dongle file.
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			body := fmt.Sprintf(`{"dongle%d": {"imei": "35900000000000%d", "calls_out": "own"}}`, i, i)
+			if status, res := do("PUT", "/dongles", body); status != 200 {
+				t.Errorf("dongle%d: expected status 200 got %d %s", i, status, res)
+			}
+		}(i)
+	}
+	wg.Wait()
+	_, body := do("GET", "/dongles", "")
+	var got map[string]map[string]interface{}
+	if err := json.Unmarshal([]byte(body), &got); err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 9 {
+		t.Errorf("expected 9 dongles got %d", len(got))
+	}
+
+	// what GET returns can be edited and sent back with PUT.
+	status, body := do("PUT", "/dongles", `{"general": {"interval": 15}, "defaults": {"context": "from-trunk"}}`)
+	if status != 200 {
+		t.Fatalf("expected status 200 got %d %s", status, body)
+	}
+	status, res := do("PUT", "/dongles", body)
+	if status != 200 || res != body {
+		t.Errorf("expected the configuration to be accepted as it is got %d\n%s\n%s", status, body, res)
+	}
+}
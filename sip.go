@@ -0,0 +1,365 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/FarmRadioHangar/fastc/asteriskconf"
+)
+
+// The files written by the sip command. The registrations of the chan_sip trunks
+// are in a file of their own, to be included in the [general] section of
+// sip.conf, while the peers and the pjsip objects are included at the end of
+// sip.conf and pjsip.conf.
+const (
+	sipFile    = "sip_fessbox.conf"
+	sipRegFile = "sip_registrations_fessbox.conf"
+	pjsipFile  = "pjsip_fessbox.conf"
+)
+
+// The channel drivers a trunk can use.
+const (
+	driverSIP   = "sip"
+	driverPJSIP = "pjsip"
+)
+
+var (
+	sipDrivers    = []string{driverSIP, driverPJSIP}
+	sipTransports = []string{"udp", "tcp", "tls"}
+	codecName     = regexp.MustCompile(`^[a-z0-9_]+$`)
+)
+
+// SipTrunk is the configuration of a SIP trunk as it is sent to fastc in json.
+// The name of the trunk is its key in the json object.
+//
+// Driver is sip for chan_sip, the default, or pjsip. Codecs are the codecs
+// allowed on the trunk in order of preference, all the codecs configured in
+// asterisk are allowed when it is empty. With Register the trunk registers
+// to Host with its Username and Secret.
+type SipTrunk struct {
+	Name      string
+	Driver    string
+	Host      string
+	Port      *int
+	Username  string
+	Secret    string
+	Codecs    []string
+	Register  *bool
+	Context   string
+	Transport string
+	Number    string
+}
+
+// sipFields returns the fields of the trunk json, keyed by their json names.
+func (t *SipTrunk) sipFields() map[string]interface{} {
+	return map[string]interface{}{
+		"driver":    &t.Driver,
+		"host":      &t.Host,
+		"port":      &t.Port,
+		"username":  &t.Username,
+		"secret":    &t.Secret,
+		"codecs":    &t.Codecs,
+		"register":  &t.Register,
+		"context":   &t.Context,
+		"transport": &t.Transport,
+		"number":    &t.Number,
+	}
+}
+
+// DecodeSipConfig decodes and validates the json object src, whose keys are the
+// names of the trunks. The trunks are returned sorted by name.
+//
+// All the invalid fields are reported together, as a FieldErrors.
+func DecodeSipConfig(src []byte) ([]*SipTrunk, error) {
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(src, &raw); err != nil {
+		return nil, err
+	}
+	var names []string
+	for k := range raw {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	var trunks []*SipTrunk
+	var errs FieldErrors
+	for _, name := range names {
+		var obj map[string]json.RawMessage
+		if err := json.Unmarshal(raw[name], &obj); err != nil {
+			errs = append(errs, &FieldError{Kind: trunkKind, Dongle: name, Msg: "must be a json object"})
+			continue
+		}
+		t := &SipTrunk{Name: name}
+		trunks = append(trunks, t)
+		decoded := decodeFields(name, obj, t.sipFields())
+		for _, v := range decoded {
+			v.Kind = trunkKind
+		}
+		errs = append(errs, decoded...)
+		if e, ok := t.Validate().(FieldErrors); ok {
+			errs = append(errs, e...)
+		}
+	}
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	return trunks, nil
+}
+
+// Validate checks the fields of t, all the invalid fields are returned as a
+// FieldErrors.
+//
+// The host is required, and no field can have control characters. Registering
+// needs the username and the secret, which can not hold the : @ and /
+// separators of the chan_sip register line.
+func (t *SipTrunk) Validate() error {
+	var errs FieldErrors
+	add := func(field, msg string) {
+		errs = append(errs, &FieldError{Kind: trunkKind, Dongle: t.Name, Field: field, Msg: msg})
+	}
+	if strings.ContainsAny(t.Name, "[]();,= \t") || hasControl(t.Name) {
+		add("", "name can not be used as a section name")
+	}
+	if t.Driver != "" && !oneOf(t.Driver, sipDrivers) {
+		add("driver", "must be one of "+strings.Join(sipDrivers, ", "))
+	}
+	switch {
+	case t.Host == "":
+		add("host", "is required")
+	case strings.ContainsAny(t.Host, " \t:@/;") || hasControl(t.Host):
+		add("host", "must be a host name or an ip address")
+	}
+	if t.Port != nil && (*t.Port < 1 || *t.Port > 65535) {
+		add("port", "must be between 1 and 65535")
+	}
+	if t.Transport != "" && !oneOf(t.Transport, sipTransports) {
+		add("transport", "must be one of "+strings.Join(sipTransports, ", "))
+	}
+	for _, v := range t.Codecs {
+		if !codecName.MatchString(v) {
+			add("codecs", fmt.Sprintf("has an invalid codec %q", v))
+		}
+	}
+	if t.Number != "" && !e164.MatchString(t.Number) {
+		add("number", "must be in E.164 format, like +255686442266")
+	}
+	if t.Secret != "" && t.Username == "" {
+		add("secret", "needs a username")
+	}
+	for _, v := range []struct{ field, value string }{
+		{"username", t.Username},
+		{"secret", t.Secret},
+		{"context", t.Context},
+	} {
+		if hasControl(v.value) {
+			add(v.field, "must not have control characters")
+		}
+	}
+	if t.Register != nil && *t.Register {
+		if t.Username == "" || t.Secret == "" {
+			add("register", "needs a username and a secret")
+		}
+		if t.driver() == driverSIP {
+			for _, v := range []struct{ field, value string }{
+				{"username", t.Username},
+				{"secret", t.Secret},
+			} {
+				if strings.ContainsAny(v.value, ":@/") {
+					add(v.field, "can not hold : @ or / when registering")
+				}
+			}
+		}
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// driver returns the channel driver of t.
+func (t *SipTrunk) driver() string {
+	if t.Driver == "" {
+		return driverSIP
+	}
+	return t.Driver
+}
+
+// registers returns true if t registers to its host.
+func (t *SipTrunk) registers() bool {
+	return t.Register != nil && *t.Register
+}
+
+// hostPort returns the host of t, followed by its port when it is set.
+func (t *SipTrunk) hostPort() string {
+	if t.Port == nil {
+		return t.Host
+	}
+	return t.Host + ":" + strconv.Itoa(*t.Port)
+}
+
+// context returns the dialplan context of the incoming calls of t.
+func (t *SipTrunk) context() string {
+	if t.Context == "" {
+		return "from-trunk"
+	}
+	return t.Context
+}
+
+// codecOptions returns the options restricting the codecs of t, if any.
+func (t *SipTrunk) codecOptions() [][2]string {
+	if len(t.Codecs) == 0 {
+		return nil
+	}
+	o := [][2]string{{"disallow", "all"}}
+	for _, v := range t.Codecs {
+		o = append(o, [2]string{"allow", v})
+	}
+	return o
+}
+
+// sipOptions returns the options of the chan_sip peer of t.
+func (t *SipTrunk) sipOptions() [][2]string {
+	o := [][2]string{
+		{"type", "peer"},
+		{"host", t.Host},
+	}
+	if t.Port != nil {
+		o = append(o, [2]string{"port", strconv.Itoa(*t.Port)})
+	}
+	if t.Username != "" {
+		o = append(o,
+			[2]string{"defaultuser", t.Username},
+			[2]string{"fromuser", t.Username},
+		)
+	}
+	if t.Secret != "" {
+		o = append(o, [2]string{"secret", t.Secret})
+	}
+	o = append(o,
+		[2]string{"context", t.context()},
+		[2]string{"insecure", "port,invite"},
+		[2]string{"qualify", "yes"},
+	)
+	if t.Transport != "" {
+		o = append(o, [2]string{"transport", t.Transport})
+	}
+	return append(o, t.codecOptions()...)
+}
+
+// register returns the chan_sip register line of t.
+func (t *SipTrunk) register() string {
+	return fmt.Sprintf("%s:%s@%s/%s", t.Username, t.Secret, t.hostPort(), t.Username)
+}
+
+// sipSection is the name and the options of a section of a generated file.
+type sipSection struct {
+	name string
+	opts [][2]string
+}
+
+// pjsipSections returns the pjsip objects of t. The endpoint is named after the
+// trunk, the other objects add a suffix to its name.
+func (t *SipTrunk) pjsipSections() []sipSection {
+	auth := t.Name + "-auth"
+	aor := t.Name + "-aor"
+	endpoint := [][2]string{
+		{"type", "endpoint"},
+		{"context", t.context()},
+		{"aors", aor},
+	}
+	if t.Username != "" {
+		endpoint = append(endpoint,
+			[2]string{"outbound_auth", auth},
+			[2]string{"from_user", t.Username},
+		)
+	}
+	if t.Transport != "" {
+		endpoint = append(endpoint, [2]string{"transport", "transport-" + t.Transport})
+	}
+	endpoint = append(endpoint, t.codecOptions()...)
+	o := []sipSection{{t.Name, endpoint}}
+	add := func(name string, opts ...[2]string) {
+		o = append(o, sipSection{name, opts})
+	}
+	if t.Username != "" {
+		add(auth,
+			[2]string{"type", "auth"},
+			[2]string{"auth_type", "userpass"},
+			[2]string{"username", t.Username},
+			[2]string{"password", t.Secret},
+		)
+	}
+	add(aor,
+		[2]string{"type", "aor"},
+		[2]string{"contact", "sip:" + t.hostPort()},
+		[2]string{"qualify_frequency", "60"},
+	)
+	if t.registers() {
+		add(t.Name+"-reg",
+			[2]string{"type", "registration"},
+			[2]string{"outbound_auth", auth},
+			[2]string{"server_uri", "sip:" + t.hostPort()},
+			[2]string{"client_uri", "sip:" + t.Username + "@" + t.hostPort()},
+			[2]string{"retry_interval", "60"},
+		)
+	}
+	add(t.Name+"-identify",
+		[2]string{"type", "identify"},
+		[2]string{"endpoint", t.Name},
+		[2]string{"match", t.Host},
+	)
+	return o
+}
+
+// templateData returns the fields of t as they are used by the dialplan
+// template. dial is the channel the outbound calls are dialed on.
+func (t *SipTrunk) templateData() map[string]interface{} {
+	dial := "SIP/" + t.Name
+	if t.driver() == driverPJSIP {
+		dial = "PJSIP/" + t.Name
+	}
+	return map[string]interface{}{
+		"name":   t.Name,
+		"number": t.Number,
+		"dial":   dial,
+	}
+}
+
+// SipAST returns the contents of the sip, registrations and pjsip files for
+// trunks. The files are generated as a whole, one section per chan_sip trunk
+// and one section per pjsip object.
+func SipAST(trunks []*SipTrunk) (sip, reg, pjsip *asteriskconf.Ast, err error) {
+	sip, reg, pjsip = &asteriskconf.Ast{}, &asteriskconf.Ast{}, &asteriskconf.Ast{}
+	add := func(a *asteriskconf.Ast, name string, opts [][2]string) error {
+		s := asteriskconf.NewSection(name)
+		if err := a.AddSection(s); err != nil {
+			return err
+		}
+		for _, opt := range opts {
+			s.Add(asteriskconf.NewIdent(opt[0], opt[1]))
+		}
+		return nil
+	}
+	regs := asteriskconf.NewSection("main")
+	reg.Sections = append(reg.Sections, regs)
+	for _, t := range trunks {
+		if t.driver() == driverPJSIP {
+			for _, v := range t.pjsipSections() {
+				if err = add(pjsip, v.name, v.opts); err != nil {
+					return nil, nil, nil, err
+				}
+			}
+			continue
+		}
+		if err = add(sip, t.Name, t.sipOptions()); err != nil {
+			return nil, nil, nil, err
+		}
+		if t.registers() {
+			regs.Add(asteriskconf.NewObject("register", t.register()))
+		}
+	}
+	return sip, reg, pjsip, nil
+}
@@ -0,0 +1,289 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/FarmRadioHangar/fastc/asteriskconf"
+)
+
+const sipConfig = `{
+	"voipms": {
+		"host": "toronto.voip.ms",
+		"username": "100000",
+		"secret": "s3cret",
+		"codecs": ["ulaw", "g729"],
+		"register": true,
+		"number": "+15145550100"
+	},
+	"telnyx": {
+		"driver": "pjsip",
+		"host": "sip.telnyx.com",
+		"port": 5060,
+		"username": "fessbox",
+		"secret": "p@ss",
+		"register": true,
+		"transport": "udp"
+	},
+	"lan": {
+		"host": "10.0.0.2",
+		"context": "from-lan"
+	}
+}`
+
+func TestSipAST(t *testing.T) {
+	trunks, err := DecodeSipConfig([]byte(sipConfig))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, v := range trunks {
+		names = append(names, v.Name)
+	}
+	if strings.Join(names, ",") != "lan,telnyx,voipms" {
+		t.Errorf("expected the trunks sorted by name got %v", names)
+	}
+	sip, reg, pjsip, err := SipAST(trunks)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := []struct {
+		a   *asteriskconf.Ast
+		out string
+	}{
+		{sip, `[lan]
+type=peer
+host=10.0.0.2
+context=from-lan
+insecure=port,invite
+qualify=yes
+
+[voipms]
+type=peer
+host=toronto.voip.ms
+defaultuser=100000
+fromuser=100000
+secret=s3cret
+context=from-trunk
+insecure=port,invite
+qualify=yes
+disallow=all
+allow=ulaw
+allow=g729
+`},
+		{reg, `register=>100000:s3cret@toronto.voip.ms/100000
+`},
+		{pjsip, `[telnyx]
+type=endpoint
+context=from-trunk
+aors=telnyx-aor
+outbound_auth=telnyx-auth
+from_user=fessbox
+transport=transport-udp
+
+[telnyx-auth]
+type=auth
+auth_type=userpass
+username=fessbox
+password=p@ss
+
+[telnyx-aor]
+type=aor
+contact=sip:sip.telnyx.com:5060
+qualify_frequency=60
+
+[telnyx-reg]
+type=registration
+outbound_auth=telnyx-auth
+server_uri=sip:sip.telnyx.com:5060
+client_uri=sip:fessbox@sip.telnyx.com:5060
+retry_interval=60
+
+[telnyx-identify]
+type=identify
+endpoint=telnyx
+match=sip.telnyx.com
+`},
+	}
+	for i, v := range expect {
+		var buf bytes.Buffer
+		if err := asteriskconf.PrintCST(&buf, v.a); err != nil {
+			t.Fatal(err)
+		}
+		if buf.String() != v.out {
+			t.Errorf("%d: expected\n%s\ngot\n%s", i, v.out, buf.String())
+		}
+	}
+}
+
+func TestDecodeSipConfigErrors(t *testing.T) {
+	src := `{
+	"voipms": {
+		"host": "toronto.voip.ms:5060",
+		"username": "100000",
+		"secret": "s3:cret",
+		"register": true,
+		"codecs": "ulaw"
+	},
+	"telnyx": {
+		"driver": "iax",
+		"port": 70000,
+		"transport": "sctp",
+		"secret": "p@ss",
+		"register": true
+	},
+	"lan": 1,
+	"wan\n[evil]": {
+		"host": "sip.example.com\r\nallow=all",
+		"username": "100000\n",
+		"secret": "s3cret\ntype=friend",
+		"context": "from-trunk\n[evil]"
+	}
+}`
+	_, err := DecodeSipConfig([]byte(src))
+	errs, ok := err.(FieldErrors)
+	if !ok {
+		t.Fatalf("expected FieldErrors got %v", err)
+	}
+	expect := []string{
+		"trunk lan: must be a json object",
+		"trunk telnyx: driver must be one of sip, pjsip",
+		"trunk telnyx: host is required",
+		"trunk telnyx: port must be between 1 and 65535",
+		"trunk telnyx: transport must be one of udp, tcp, tls",
+		"trunk telnyx: secret needs a username",
+		"trunk telnyx: register needs a username and a secret",
+		"trunk voipms: codecs must be a list of strings",
+		"trunk voipms: host must be a host name or an ip address",
+		"trunk voipms: secret can not hold : @ or / when registering",
+		"trunk wan\n[evil]: name can not be used as a section name",
+		"trunk wan\n[evil]: host must be a host name or an ip address",
+		"trunk wan\n[evil]: username must not have control characters",
+		"trunk wan\n[evil]: secret must not have control characters",
+		"trunk wan\n[evil]: context must not have control characters",
+	}
+	if len(errs) != len(expect) {
+		t.Fatalf("expected %d errors got %d\n%v", len(expect), len(errs), errs)
+	}
+	for i, v := range expect {
+		if errs[i].Error() != v {
+			t.Errorf("expected %q got %q", v, errs[i].Error())
+		}
+	}
+}
+
+func TestWriteSip(t *testing.T) {
+	dir, clean := asteriskTestDir(t)
+	defer clean()
+
+	c, err := DecodeConfig([]byte(`{"airtel1": {"imei": "353220047976425", "calls_out": "own"}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = writeDongles(c); err != nil {
+		t.Fatal(err)
+	}
+	trunks, err := DecodeSipConfig([]byte(sipConfig))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = writeSip(trunks); err != nil {
+		t.Fatal(err)
+	}
+	read := func(name string) string {
+		b, err := ioutil.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(b)
+	}
+	for _, name := range []string{sipFile, sipRegFile, pjsipFile} {
+		if read(name) == "" {
+			t.Errorf("expected %s to be written", name)
+		}
+		info, err := os.Stat(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Mode().Perm() != 0600 {
+			t.Errorf("expected %s to only be readable by its owner got %v", name, info.Mode())
+		}
+	}
+
+	// the dongles are kept in the dialplan when the sip trunks are written,
+	// and the sip trunks when the dongles are written again.
+	for i := 0; i < 2; i++ {
+		plan := read(diaplanOut)
+		for _, v := range []string{
+			"OUT_19 = AMP:Dongle/airtel1/$OUTNUM$",
+			"OUT_20 = SIP/lan",
+			"OUT_21 = PJSIP/telnyx",
+			"OUT_22 = SIP/voipms",
+			"OUTCID_22 = +15145550100",
+			"exten => _X.,n,Macro(dialout-trunk,21,${EXTEN},,off)",
+		} {
+			if !strings.Contains(plan, v) {
+				t.Errorf("%d: expected %s in the dialplan", i, v)
+			}
+		}
+		if err = writeDongles(c); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestWriteSipWithoutDongleState(t *testing.T) {
+	dir, clean := asteriskTestDir(t)
+	defer clean()
+
+	trunks, err := DecodeSipConfig([]byte(sipConfig))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// nothing to keep before any dongle is configured.
+	if err = writeSip(trunks); err != nil {
+		t.Fatal(err)
+	}
+
+	// the dongles written by a version of fastc that did not keep them in the
+	// trunk state would be dropped from the dialplan.
+	conf := "[airtel1]\nimei=353220047976425\n"
+	err = ioutil.WriteFile(filepath.Join(dir, dongleFile), []byte(conf), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = writeSip(trunks); err == nil {
+		t.Fatal("expected an error for the dongles missing from the trunk state")
+	}
+	c, err := DecodeConfig([]byte(`{"airtel1": {"imei": "353220047976425", "calls_out": "own"}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = writeDongles(c); err != nil {
+		t.Fatal(err)
+	}
+	if err = writeSip(trunks); err != nil {
+		t.Fatal(err)
+	}
+	b, err := ioutil.ReadFile(filepath.Join(dir, diaplanOut))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(b), "AMP:Dongle/airtel1/$OUTNUM$") {
+		t.Error("expected the dongle to be kept in the dialplan")
+	}
+}
+
+// writeSip writes the files of the sip command for trunks.
+func writeSip(trunks []*SipTrunk) error {
+	files, err := sipFiles(trunks)
+	if err != nil {
+		return err
+	}
+	return files.commit()
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+
+	"github.com/FarmRadioHangar/fastc/asteriskconf"
+)
+
+// trunkFile is the file in the asterisk configuration directory where the trunk
+// ids given to the dongles are kept between runs.
+const trunkFile = "fastc_trunks.json"
+
+var outTrunk = regexp.MustCompile(`^OUT_([0-9]+)$`)
+
+// trunk is the trunk id given to a dongle or a sip trunk. Type is empty for
+// dongles, and sip for sip trunks.
+type trunk struct {
+	Type string `json:"type,omitempty"`
+	Name string `json:"name"`
+	IMEI string `json:"imei,omitempty"`
+	ID   int    `json:"id"`
+}
+
+// sipTrunkType is the Type of the ids given to sip trunks.
+const sipTrunkType = "sip"
+
+// trunkState holds the trunk ids given to the dongles. An id is never given to
+// another dongle, even after the dongle it was given to is removed, so that
+// the outbound routes using it do not change trunk.
+type trunkState struct {
+	Trunks []*trunk `json:"trunks"`
+
+	// Dongles and Sip are the dialplan template data written by the last run
+	// of the dongles and sip commands. Each command replaces its own entries
+	// and keeps the entries of the other one in the dialplan. Dongles is nil
+	// until the dongles command is run.
+	Dongles []map[string]interface{} `json:"dongles"`
+	Sip     []map[string]interface{} `json:"sip,omitempty"`
+
+	// reserved are the ids used by the trunks defined in the dialplan template,
+	// and claimed are the trunks given in this run.
+	reserved map[int]bool
+	claimed  map[*trunk]bool
+}
+
+// loadTrunks reads the trunk ids kept in dir. The returned state is empty if
+// no trunk ids were kept yet.
+func loadTrunks(dir string) (*trunkState, error) {
+	s := &trunkState{}
+	b, err := ioutil.ReadFile(filepath.Join(dir, trunkFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return s, nil
+		}
+		return nil, err
+	}
+	if err = json.Unmarshal(b, s); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// encode returns the content of the trunk file for s.
+func (s *trunkState) encode() ([]byte, error) {
+	return json.MarshalIndent(s, "", "\t")
+}
+
+// reserveGlobals reserves the ids of the OUT_N trunks defined in the [globals]
+// section of the dialplan template tpl.
+func (s *trunkState) reserveGlobals(tpl []byte) error {
+	p, err := asteriskconf.NewParser(bytes.NewReader(tpl))
+	if err != nil {
+		return err
+	}
+	a, err := p.Parse()
+	if err != nil {
+		return err
+	}
+	globals, err := a.Section("globals")
+	if err != nil {
+		return nil
+	}
+	if s.reserved == nil {
+		s.reserved = make(map[int]bool)
+	}
+	for _, v := range globals.Values() {
+		if m := outTrunk.FindStringSubmatch(v.Key()); m != nil {
+			id, _ := strconv.Atoi(m[1])
+			s.reserved[id] = true
+		}
+	}
+	return nil
+}
+
+// assign returns the trunk id of the trunk name of type typ with the given imei,
+// giving it a new id that is not lower than from if it has none.
+//
+// A dongle keeps the id given to its imei, even when it is renamed. A dongle
+// with no known imei gets the id given to its name, unless the id was given to
+// a modem with another imei. Sip trunks have no imei and are found by name.
+func (s *trunkState) assign(typ, name, imei string, from int) int {
+	if s.claimed == nil {
+		s.claimed = make(map[*trunk]bool)
+	}
+	var t *trunk
+	if imei != "" {
+		for _, v := range s.Trunks {
+			if v.Type == typ && v.IMEI == imei && !s.claimed[v] {
+				t = v
+				break
+			}
+		}
+	}
+	if t == nil {
+		for _, v := range s.Trunks {
+			if v.Type == typ && v.Name == name && !s.claimed[v] &&
+				(v.IMEI == "" || imei == "" || v.IMEI == imei) {
+				t = v
+				break
+			}
+		}
+	}
+	if t == nil {
+		t = &trunk{Type: typ, ID: s.next(from)}
+		s.Trunks = append(s.Trunks, t)
+	}
+	t.Name = name
+	if imei != "" {
+		t.IMEI = imei
+	}
+	s.claimed[t] = true
+	return t.ID
+}
+
+// next returns the lowest id from from that is neither reserved nor given to a
+// dongle.
+func (s *trunkState) next(from int) int {
+	used := make(map[int]bool)
+	for _, v := range s.Trunks {
+		used[v.ID] = true
+	}
+	for id := from; ; id++ {
+		if !used[id] && !s.reserved[id] {
+			return id
+		}
+	}
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestTrunkAssign(t *testing.T) {
+	s := &trunkState{reserved: map[int]bool{19: true}}
+	if id := s.assign("", "airtel1", "353220047976425", 19); id != 20 {
+		t.Errorf("expected 20 got %d", id)
+	}
+	if id := s.assign("", "tigo1", "", 19); id != 21 {
+		t.Errorf("expected 21 got %d", id)
+	}
+
+	// a new run, airtel1 was moved to zantel1 and a modem with another imei
+	// took the name tigo1
+	s = &trunkState{Trunks: s.Trunks, reserved: s.reserved}
+	if id := s.assign("", "vodacom1", "", 19); id != 22 {
+		t.Errorf("expected 22 got %d", id)
+	}
+	if id := s.assign("", "zantel1", "353220047976425", 19); id != 20 {
+		t.Errorf("expected zantel1 to keep 20 got %d", id)
+	}
+	if id := s.assign("", "tigo1", "352215045819420", 19); id != 21 {
+		t.Errorf("expected tigo1 to keep 21 got %d", id)
+	}
+	if id := s.assign("", "airtel1", "354369047238580", 19); id != 23 {
+		t.Errorf("expected 23 got %d", id)
+	}
+}
+
+func TestWriteDialPlanTrunks(t *testing.T) {
+	dir, clean := asteriskTestDir(t)
+	defer clean()
+
+	run := func(dongles ...*Dongle) string {
+		var data []map[string]interface{}
+		for _, v := range dongles {
+			v.CallsOut = "own"
+			data = append(data, v.templateData())
+		}
+		files := newFileSet(dir)
+		err := addDialPlan(files, func(ctx *TemplateContext) error {
+			ctx.Dongles = data
+			return nil
+		})
+		if err == nil {
+			err = files.commit()
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := ioutil.ReadFile(filepath.Join(dir, diaplanOut))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(b)
+	}
+	out := run(&Dongle{Name: "tigo1", IMEI: "352215045819420"})
+	if !strings.Contains(out, "OUT_19 = AMP:Dongle/tigo1/$OUTNUM$") {
+		t.Errorf("expected tigo1 to be trunk 19")
+	}
+	out = run(&Dongle{Name: "airtel1", IMEI: "353220047976425"},
+		&Dongle{Name: "tigo1", IMEI: "352215045819420"})
+	for _, v := range []string{
+		"OUT_19 = AMP:Dongle/tigo1/$OUTNUM$",
+		"OUT_20 = AMP:Dongle/airtel1/$OUTNUM$",
+		"OUT_18 = SIP/voipstreet",
+	} {
+		if !strings.Contains(out, v) {
+			t.Errorf("expected %s in the dialplan", v)
+		}
+	}
+}
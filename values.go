@@ -0,0 +1,175 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/FarmRadioHangar/fastc/asteriskconf"
+	"github.com/urfave/cli"
+)
+
+// valuePath is the address of the values of a key in an asterisk configuration
+// file. index is the definition of the key it refers to, counting from 0, or -1
+// for all of them.
+type valuePath struct {
+	section string
+	key     string
+	index   int
+}
+
+// parseValuePath parses the path section.key or section.key[index]. The section
+// is the part before the last dot, a path without a dot refers to a key defined
+// before the first section.
+func parseValuePath(s string) (*valuePath, error) {
+	p := &valuePath{section: "main", key: s, index: -1}
+	if i := strings.LastIndex(s, "."); i != -1 {
+		p.section, p.key = s[:i], s[i+1:]
+	}
+	if strings.HasSuffix(p.key, "]") {
+		i := strings.LastIndex(p.key, "[")
+		if i == -1 {
+			return nil, fmt.Errorf("bad path %s", s)
+		}
+		n, err := strconv.Atoi(p.key[i+1 : len(p.key)-1])
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("bad index in path %s", s)
+		}
+		p.key, p.index = p.key[:i], n
+	}
+	if p.section == "" || p.key == "" {
+		return nil, fmt.Errorf("bad path %s, expected section.key", s)
+	}
+	return p, nil
+}
+
+// valueArgs returns the file and the path given as the first arguments of the
+// get, set and unset commands.
+func valueArgs(ctx *cli.Context) (string, *valuePath, error) {
+	args := ctx.Args()
+	if len(args) < 2 {
+		return "", nil, errors.New("supply a config file and a section.key path")
+	}
+	p, err := parseValuePath(args[1])
+	if err != nil {
+		return "", nil, err
+	}
+	return args[0], p, nil
+}
+
+// readValueFile parses the configuration file at path, without following its
+// includes.
+func readValueFile(path string) (*asteriskconf.Ast, error) {
+	return asteriskconf.ParseFile(filepath.Dir(path), filepath.Base(path), asteriskconf.IncludeNone)
+}
+
+// values returns the values of the definitions of p.key in the section of a,
+// as they are written in the file.
+func (p *valuePath) values(a *asteriskconf.Ast) ([]string, error) {
+	sec, err := a.Section(p.section)
+	if err != nil {
+		return nil, fmt.Errorf("section %s not found", p.section)
+	}
+	var o []string
+	for _, v := range sec.Values() {
+		if v.Key() == p.key {
+			o = append(o, v.Value())
+		}
+	}
+	if len(o) == 0 {
+		return nil, fmt.Errorf("key %s not found in section %s", p.key, p.section)
+	}
+	return o, nil
+}
+
+// Get prints the values of a key of a configuration file, one per line.
+func Get(ctx *cli.Context) error {
+	file, p, err := valueArgs(ctx)
+	if err != nil {
+		return err
+	}
+	a, err := readValueFile(file)
+	if err != nil {
+		return err
+	}
+	all, err := p.values(a)
+	if err != nil {
+		return err
+	}
+	if p.index != -1 {
+		if p.index >= len(all) {
+			return fmt.Errorf("index %d out of range, section %s has %d definitions of %s",
+				p.index, p.section, len(all), p.key)
+		}
+		all = all[p.index : p.index+1]
+	}
+	for _, v := range all {
+		fmt.Fprintln(ctx.App.Writer, v)
+	}
+	return nil
+}
+
+// Set sets the value of a key of a configuration file. The section is added
+// when it does not exist.
+func Set(ctx *cli.Context) error {
+	file, p, err := valueArgs(ctx)
+	if err != nil {
+		return err
+	}
+	if len(ctx.Args()) != 3 {
+		return errors.New("supply a config file, a section.key path and a value")
+	}
+	value := ctx.Args()[2]
+	return editValueFile(ctx, file, func(a *asteriskconf.Ast) error {
+		if _, err := a.Section(p.section); err != nil {
+			if err = a.AddSection(asteriskconf.NewSection(p.section)); err != nil {
+				return err
+			}
+		}
+		if p.index == -1 {
+			return a.SetValue(p.section, p.key, value)
+		}
+		return a.SetValueAt(p.section, p.key, p.index, value)
+	})
+}
+
+// Unset removes a key, or one of its definitions, from a configuration file.
+func Unset(ctx *cli.Context) error {
+	file, p, err := valueArgs(ctx)
+	if err != nil {
+		return err
+	}
+	return editValueFile(ctx, file, func(a *asteriskconf.Ast) error {
+		if p.index == -1 {
+			return a.DeleteKey(p.section, p.key)
+		}
+		return a.DeleteKeyAt(p.section, p.key, p.index)
+	})
+}
+
+// editValueFile applies edit to the configuration file at path and writes it
+// back in place, keeping its formatting and permissions. A symbolic link is
+// followed, so that the file it points to is the one replaced.
+func editValueFile(ctx *cli.Context, path string, edit func(*asteriskconf.Ast) error) error {
+	files, err := replaceFile(path, func(path string) ([]byte, error) {
+		a, err := readValueFile(path)
+		if err != nil {
+			return nil, err
+		}
+		if err = edit(a); err != nil {
+			return nil, err
+		}
+		var buf bytes.Buffer
+		if err = asteriskconf.PrintCST(&buf, a); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	})
+	if err != nil {
+		return err
+	}
+	return applyFiles(ctx, files, nil)
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/urfave/cli"
+)
+
+func TestParseValuePath(t *testing.T) {
+	sample := []struct {
+		path    string
+		section string
+		key     string
+		index   int
+	}{
+		{"airtel1.imei", "airtel1", "imei", -1},
+		{"airtel1.audio[1]", "airtel1", "audio", 1},
+		{"trunk.example.com.host", "trunk.example.com", "host", -1},
+		{"language", "main", "language", -1},
+	}
+	for _, v := range sample {
+		p, err := parseValuePath(v.path)
+		if err != nil {
+			t.Errorf("%s: %v", v.path, err)
+			continue
+		}
+		if p.section != v.section || p.key != v.key || p.index != v.index {
+			t.Errorf("%s: expected %s %s %d got %s %s %d", v.path,
+				v.section, v.key, v.index, p.section, p.key, p.index)
+		}
+	}
+	for _, v := range []string{"", "airtel1.", ".imei", "airtel1.audio[x]", "airtel1.audio[-1]", "airtel1.audio]"} {
+		if _, err := parseValuePath(v); err == nil {
+			t.Errorf("%q: expected an error", v)
+		}
+	}
+}
+
+func TestGetSetUnset(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fastc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "dongle.conf")
+	src := `[general]
+interval=15 ; seconds
+
+; the first modem
+[airtel1]
+imei = 353220047976425
+audio=/dev/ttyUSB1
+`
+	if err = ioutil.WriteFile(file, []byte(src), 0600); err != nil {
+		t.Fatal(err)
+	}
+	run := func(args ...string) (string, error) {
+		var buf bytes.Buffer
+		app := newApp()
+		app.Writer = &buf
+		app.ExitErrHandler = func(*cli.Context, error) {}
+		err := app.Run(append([]string{"fastc"}, args...))
+		return buf.String(), err
+	}
+
+	out, err := run("get", file, "airtel1.imei")
+	if err != nil || out != "353220047976425\n" {
+		t.Errorf("get: expected the imei got %q %v", out, err)
+	}
+	for _, v := range [][]string{
+		{"set", file, "airtel1.imei", "353220047976426"},
+		{"set", file, "airtel1.audio[1]", "/dev/ttyUSB4"},
+		{"set", file, "tigo1.imei", "352215045819420"},
+		{"unset", file, "general.interval"},
+	} {
+		if _, err = run(v...); err != nil {
+			t.Fatalf("%v: %v", v, err)
+		}
+	}
+	out, err = run("get", file, "airtel1.audio")
+	if err != nil || out != "/dev/ttyUSB1\n/dev/ttyUSB4\n" {
+		t.Errorf("get: expected both audio values got %q %v", out, err)
+	}
+	out, err = run("get", file, "airtel1.audio[1]")
+	if err != nil || out != "/dev/ttyUSB4\n" {
+		t.Errorf("get: expected the second audio value got %q %v", out, err)
+	}
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := `[general]
+
+; the first modem
+[airtel1]
+imei = 353220047976426
+audio=/dev/ttyUSB1
+audio=/dev/ttyUSB4
+
+[tigo1]
+imei=352215045819420
+`
+	if string(b) != expect {
+		t.Errorf("expected\n%s\ngot\n%s", expect, b)
+	}
+	info, err := os.Stat(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("expected the permissions to be kept got %v", info.Mode())
+	}
+
+	out, err = run("unset", "--dry-run", file, "airtel1.audio[0]")
+	if e, ok := err.(cli.ExitCoder); !ok || e.ExitCode() != 1 {
+		t.Errorf("expected exit status 1 got %v", err)
+	}
+	if !bytes.Contains([]byte(out), []byte("-audio=/dev/ttyUSB1\n")) {
+		t.Errorf("expected the removed value in the diff got\n%s", out)
+	}
+	for _, v := range [][]string{
+		{"get", file, "airtel1.secret"},
+		{"get", file, "vodacom1.imei"},
+		{"get", file, "airtel1.audio[2]"},
+		{"set", file, "airtel1.audio[3]", "/dev/ttyUSB5"},
+		{"unset", file, "airtel1.secret"},
+		{"set", file, "airtel1.imei"},
+		{"set", file, "airtel1.imei", "1\n[evil]"},
+	} {
+		if _, err = run(v...); err == nil {
+			t.Errorf("%v: expected an error", v)
+		}
+	}
+	if b2, _ := ioutil.ReadFile(file); !bytes.Equal(b, b2) {
+		t.Errorf("expected the file to be left unchanged got\n%s", b2)
+	}
+	if _, err = os.Stat(filepath.Join(dir, backupDir)); !os.IsNotExist(err) {
+		t.Errorf("expected no backup to be made got %v", err)
+	}
+}